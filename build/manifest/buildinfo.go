@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// buildInfo is the metadata stamped into the server executable by the linker, into the
+// variables declared by the generated server manifest. The Go version isn't stamped, since the
+// server reports the version it was actually compiled with at runtime.
+type buildInfo struct {
+	Commit    string `json:"commit"`
+	Dirty     bool   `json:"dirty"`
+	BuildTime string `json:"build_time"`
+}
+
+// collectBuildInfo describes the git checkout at root, if any. The build time honours
+// SOURCE_DATE_EPOCH, so that reproducible builds can pin it.
+func collectBuildInfo(root string) (*buildInfo, error) {
+	buildTime := time.Now()
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse SOURCE_DATE_EPOCH %s", epoch)
+		}
+		buildTime = time.Unix(seconds, 0)
+	}
+
+	info := &buildInfo{BuildTime: buildTime.UTC().Format(time.RFC3339)}
+
+	commit, err := runGit(root, "rev-parse", "HEAD")
+	if err != nil {
+		// Not a git checkout, such as a source archive: there is no commit to report.
+		return info, nil
+	}
+	info.Commit = commit
+
+	status, err := runGit(root, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	info.Dirty = status != ""
+
+	return info, nil
+}
+
+// ldflags returns the linker flags setting the server's build variables.
+func (b *buildInfo) ldflags() string {
+	return fmt.Sprintf("-X main.buildCommit=%s -X main.buildDirty=%t -X main.buildTime=%s", b.Commit, b.Dirty, b.BuildTime)
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
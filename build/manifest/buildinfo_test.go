@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBuildInfoLdflags(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		info     buildInfo
+		expected string
+	}{
+		{
+			name:     "clean",
+			info:     buildInfo{Commit: "0123456789abcdef0123456789abcdef01234567", BuildTime: "2019-01-02T03:04:05Z"},
+			expected: "-X main.buildCommit=0123456789abcdef0123456789abcdef01234567 -X main.buildDirty=false -X main.buildTime=2019-01-02T03:04:05Z",
+		},
+		{
+			name:     "dirty",
+			info:     buildInfo{Commit: "0123456789abcdef0123456789abcdef01234567", Dirty: true, BuildTime: "2019-01-02T03:04:05Z"},
+			expected: "-X main.buildCommit=0123456789abcdef0123456789abcdef01234567 -X main.buildDirty=true -X main.buildTime=2019-01-02T03:04:05Z",
+		},
+		{
+			name:     "not a git checkout",
+			info:     buildInfo{BuildTime: "2019-01-02T03:04:05Z"},
+			expected: "-X main.buildCommit= -X main.buildDirty=false -X main.buildTime=2019-01-02T03:04:05Z",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if ldflags := test.info.ldflags(); ldflags != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, ldflags)
+			}
+		})
+	}
+}
+
+// TestBuildInfoLdflagsMatchServerManifest guards against renaming the variables in the generated
+// server manifest without updating the flags, which the linker would silently ignore.
+func TestBuildInfoLdflagsMatchServerManifest(t *testing.T) {
+	info := &buildInfo{Commit: "abc", BuildTime: "2019-01-02T03:04:05Z"}
+	for _, match := range regexp.MustCompile(`-X main\.(\w+)=`).FindAllStringSubmatch(info.ldflags(), -1) {
+		declaration := regexp.MustCompile(`(?m)^\t` + match[1] + ` +string$`)
+		if !declaration.MatchString(manifestGoFileTemplate) {
+			t.Errorf("generated server manifest doesn't declare %s as a string", match[1])
+		}
+	}
+}
+
+func TestCollectBuildInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+	os.Setenv("SOURCE_DATE_EPOCH", "1546398245")
+
+	info, err := collectBuildInfo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (buildInfo{BuildTime: "2019-01-02T03:04:05Z"}); *info != expected {
+		t.Errorf("expected %+v outside a git checkout, got %+v", expected, *info)
+	}
+
+	git := func(args ...string) string {
+		output, err := runGit(dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if err != nil {
+			t.Skip(err)
+		}
+		return output
+	}
+	git("init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(dir, "plugin.json"), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "plugin.json")
+	git("commit", "-q", "-m", "initial")
+	commit := git("rev-parse", "HEAD")
+
+	info, err = collectBuildInfo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (buildInfo{Commit: commit, BuildTime: "2019-01-02T03:04:05Z"}); *info != expected {
+		t.Errorf("expected %+v for a clean checkout, got %+v", expected, *info)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "plugin.json"), []byte("{\"id\": \"com.example.test\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = collectBuildInfo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Dirty {
+		t.Error("expected a checkout with changes to be dirty")
+	}
+	if !strings.Contains(info.ldflags(), "-X main.buildDirty=true") {
+		t.Errorf("expected the dirty flag to be stamped, got %q", info.ldflags())
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := collectBuildInfo(dir); err == nil || !strings.Contains(err.Error(), "failed to parse SOURCE_DATE_EPOCH yesterday") {
+		t.Errorf("expected an error for an invalid SOURCE_DATE_EPOCH, got %v", err)
+	}
+}
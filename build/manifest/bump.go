@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strconv"
+
+	"github.com/blang/semver"
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// bumpVersion returns the version following current for the given part, one of major, minor,
+// patch or prerelease. A prerelease bump requires a tag, e.g. 1.2.3 becomes 1.2.4-rc.0, and
+// 1.2.4-rc.0 becomes 1.2.4-rc.1. The result is rejected unless it sorts above current.
+func bumpVersion(current, part, tag string) (string, error) {
+	version, err := semver.Parse(current)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse version %s", current)
+	}
+	previous := version
+
+	switch part {
+	case "major":
+		version = semver.Version{Major: version.Major + 1}
+
+	case "minor":
+		version = semver.Version{Major: version.Major, Minor: version.Minor + 1}
+
+	case "patch":
+		version = semver.Version{Major: version.Major, Minor: version.Minor, Patch: version.Patch + 1}
+
+	case "prerelease":
+		if tag == "" {
+			return "", errors.New("prerelease requires a tag, e.g. rc")
+		}
+		tagVersion, err := semver.NewPRVersion(tag)
+		if err != nil || tagVersion.IsNum {
+			return "", errors.Errorf("invalid prerelease tag %s", tag)
+		}
+
+		number := uint64(0)
+		if len(version.Pre) == 2 && version.Pre[0].VersionStr == tag && version.Pre[1].IsNum {
+			number = version.Pre[1].VersionNum + 1
+		} else if len(version.Pre) == 0 {
+			version.Patch++
+		}
+
+		version = semver.Version{
+			Major: version.Major,
+			Minor: version.Minor,
+			Patch: version.Patch,
+			Pre:   []semver.PRVersion{tagVersion, {VersionNum: number, IsNum: true}},
+		}
+
+	default:
+		return "", errors.Errorf("unrecognized version part %s, expected major, minor, patch or prerelease", part)
+	}
+
+	// Switching prerelease tags, such as from rc to beta, can sort below the current version.
+	if !version.GT(previous) {
+		return "", errors.Errorf("bumping %s to %s would not increase the version, bump the patch first", current, version)
+	}
+
+	return version.String(), nil
+}
+
+// bumpManifest increments the version in the manifest file in place and propagates the result
+// into the server and webapp folders, returning the new version.
+//
+// The version is replaced textually rather than by re-encoding the manifest, preserving the key
+// order and formatting of the rest of the file.
+func bumpManifest(p *project, manifest *model.Manifest, manifestPath, part, tag string) (string, error) {
+	version, err := bumpVersion(manifest.Version, part, tag)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s", manifestPath)
+	}
+
+	data, err = replaceManifestVersion(data, manifestFormat(manifestPath), manifest.Version, version)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to update %s", manifestPath)
+	}
+
+	if err := ioutil.WriteFile(manifestPath, data, 0644); err != nil {
+		return "", errors.Wrapf(err, "failed to write %s", manifestPath)
+	}
+
+	manifest.Version = version
+	if _, err := applyManifest(p, manifest); err != nil {
+		return "", errors.Wrap(err, "failed to apply manifest")
+	}
+
+	return version, nil
+}
+
+// replaceManifestVersion replaces the top-level version in the encoded manifest, which must
+// appear exactly once.
+func replaceManifestVersion(data []byte, format, current, version string) ([]byte, error) {
+	var pattern *regexp.Regexp
+	switch format {
+	case "json":
+		// Escaped quotes inside other string values are preceded by a backslash.
+		pattern = regexp.MustCompile(`(^|[^\\])("version"\s*:\s*)"` + regexp.QuoteMeta(current) + `"`)
+	case "yaml":
+		pattern = regexp.MustCompile(`(?m)^(version:[ \t]*)(["']?)` + regexp.QuoteMeta(current) + `(["']?[ \t]*(#.*)?)$`)
+	default:
+		return nil, errors.Errorf("unsupported manifest format %s", format)
+	}
+
+	matches := pattern.FindAllIndex(data, -1)
+	if len(matches) != 1 {
+		return nil, errors.Errorf("expected exactly one version field set to %s, found %d", current, len(matches))
+	}
+
+	// Keep YAML's existing quoting, if any; the quotes are part of the match in JSON.
+	replacement := "${1}${2}" + version + "${3}"
+	if format == "json" {
+		replacement = "${1}${2}" + strconv.Quote(version)
+	}
+
+	return pattern.ReplaceAll(data, []byte(replacement)), nil
+}
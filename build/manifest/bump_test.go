@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBumpVersion(t *testing.T) {
+	for _, test := range []struct {
+		current, part, tag string
+		expected           string
+		err                string
+	}{
+		{"1.2.3", "major", "", "2.0.0", ""},
+		{"1.2.3", "minor", "", "1.3.0", ""},
+		{"1.2.3", "patch", "", "1.2.4", ""},
+		{"1.2.3-rc.1", "patch", "", "1.2.4", ""},
+		{"1.2.3", "prerelease", "rc", "1.2.4-rc.0", ""},
+		{"1.2.4-rc.0", "prerelease", "rc", "1.2.4-rc.1", ""},
+		{"1.2.4-beta.3", "prerelease", "rc", "1.2.4-rc.0", ""},
+		{"1.2.4-rc.0", "prerelease", "beta", "", "would not increase the version"},
+		{"1.2.3", "prerelease", "", "", "prerelease requires a tag"},
+		{"1.2.3", "prerelease", "1", "", "invalid prerelease tag 1"},
+		{"1.2.3", "build", "", "", "unrecognized version part build"},
+		{"v1.2", "patch", "", "", "failed to parse version v1.2"},
+	} {
+		t.Run(test.current+" "+test.part+" "+test.tag, func(t *testing.T) {
+			version, err := bumpVersion(test.current, test.part, test.tag)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, version)
+			}
+		})
+	}
+}
+
+func TestReplaceManifestVersion(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		format   string
+		data     string
+		expected string
+		err      string
+	}{
+		{
+			name:     "json",
+			format:   "json",
+			data:     "{\n    \"id\": \"com.example.test\",\n    \"version\": \"0.1.0\"\n}\n",
+			expected: "{\n    \"id\": \"com.example.test\",\n    \"version\": \"0.2.0\"\n}\n",
+		},
+		{
+			name:     "json ignores escaped keys in other values",
+			format:   "json",
+			data:     `{"description": "set \"version\": \"0.1.0\"", "version": "0.1.0"}`,
+			expected: `{"description": "set \"version\": \"0.1.0\"", "version": "0.2.0"}`,
+		},
+		{
+			name:     "yaml keeps quotes and comments",
+			format:   "yaml",
+			data:     "id: com.example.test\nversion: '0.1.0' # released\n",
+			expected: "id: com.example.test\nversion: '0.2.0' # released\n",
+		},
+		{
+			name:     "yaml ignores nested versions",
+			format:   "yaml",
+			data:     "version: 0.1.0\nsettings_schema:\n  version: 0.1.0\n",
+			expected: "version: 0.2.0\nsettings_schema:\n  version: 0.1.0\n",
+		},
+		{
+			name:   "missing version",
+			format: "json",
+			data:   `{"version": "0.0.1"}`,
+			err:    "expected exactly one version field set to 0.1.0, found 0",
+		},
+		{
+			name:   "ambiguous version",
+			format: "json",
+			data:   `{"version": "0.1.0", "settings_schema": {"version": "0.1.0"}}`,
+			err:    "expected exactly one version field set to 0.1.0, found 2",
+		},
+		{
+			name:   "unsupported format",
+			format: "toml",
+			err:    "unsupported manifest format toml",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := replaceManifestVersion([]byte(test.data), test.format, "0.1.0", "0.2.0")
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// bundleEntry is a single file or directory destined for the plugin bundle.
+type bundleEntry struct {
+	// Name is the slash-separated path of the entry relative to the root of the plugin.
+	Name string
+	// Source is the path of the file on disk, empty for directories.
+	Source string
+	// Content, if set, is written in place of the file at Source.
+	Content []byte
+	Mode    int64
+	Size    int64
+}
+
+// defaultBundlePath returns the path of the bundle the Makefile expects for the given manifest.
+func defaultBundlePath(p *project, manifest *model.Manifest) string {
+	return p.path(filepath.Join("dist", fmt.Sprintf("%s-%s.tar.gz", manifest.Id, manifest.Version)))
+}
+
+// bundlePlugin writes a reproducible tar.gz of the manifest, server and webapp artifacts to
+// bundlePath, alongside a bundlePath.sha256 checksum file.
+func bundlePlugin(p *project, manifest *model.Manifest, manifestPath, bundlePath string) error {
+	entries, err := collectBundleEntries(p, manifest, manifestPath)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyBundleEntries(manifest, manifestPath, entries); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(bundlePath), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create %s", filepath.Dir(bundlePath))
+	}
+
+	bundleFile, err := os.Create(bundlePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", bundlePath)
+	}
+	defer bundleFile.Close()
+
+	hash := sha256.New()
+	if err := writeBundle(io.MultiWriter(bundleFile, hash), manifest.Id, entries); err != nil {
+		return errors.Wrapf(err, "failed to write %s", bundlePath)
+	}
+	if err := bundleFile.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write %s", bundlePath)
+	}
+
+	checksum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(hash.Sum(nil)), filepath.Base(bundlePath))
+	if err := ioutil.WriteFile(bundlePath+".sha256", []byte(checksum), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s.sha256", bundlePath)
+	}
+
+	return nil
+}
+
+// collectBundleEntries lists the manifest, any NOTICE.txt and the contents of server/dist and
+// webapp/dist under the project root, as required by the manifest, sorted by name.
+func collectBundleEntries(p *project, manifest *model.Manifest, manifestPath string) ([]bundleEntry, error) {
+	manifestInfo, err := os.Stat(manifestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat %s", manifestPath)
+	}
+
+	// The server only looks for a manifest named plugin.json or plugin.yaml in the bundle.
+	entries := []bundleEntry{{
+		Name:   "plugin." + manifestFormat(manifestPath),
+		Source: manifestPath,
+		Mode:   0644,
+		Size:   manifestInfo.Size(),
+	}}
+
+	// A version derived from git, and the executables of a configured platform matrix, are only
+	// recorded in the bundled copy of the manifest.
+	if p.GitVersion || (manifest.HasServer() && p.Platforms != nil) {
+		data, err := bundledManifest(p, manifest, manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		entries[0].Content = data
+		entries[0].Size = int64(len(data))
+	}
+
+	// The attribution file written by licenses, if any, ships alongside the manifest.
+	if noticeInfo, err := os.Stat(p.path(noticePath)); err == nil {
+		entries = append(entries, bundleEntry{
+			Name:   noticePath,
+			Source: p.path(noticePath),
+			Mode:   0644,
+			Size:   noticeInfo.Size(),
+		})
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to stat %s", noticePath)
+	}
+
+	var dirs []string
+	if manifest.HasServer() {
+		dirs = append(dirs, "server", "server/dist")
+	}
+	if manifest.HasWebapp() {
+		dirs = append(dirs, "webapp", "webapp/dist")
+	}
+
+	for _, dir := range dirs {
+		if path.Base(dir) != "dist" {
+			entries = append(entries, bundleEntry{Name: dir, Mode: 0755})
+			continue
+		}
+
+		root := p.path(dir)
+		err := filepath.Walk(root, func(walkPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(root, walkPath)
+			if err != nil {
+				return err
+			}
+
+			entry := bundleEntry{Name: path.Join(dir, filepath.ToSlash(rel))}
+			switch {
+			case info.IsDir():
+				entry.Mode = 0755
+			case info.Mode().IsRegular():
+				entry.Source = walkPath
+				entry.Size = info.Size()
+				entry.Mode = 0644
+				if info.Mode()&0111 != 0 {
+					entry.Mode = 0755
+				}
+			default:
+				return errors.Errorf("%s is not a regular file", walkPath)
+			}
+
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", dir)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	return entries, nil
+}
+
+// bundledManifest returns the manifest at manifestPath as it is bundled, with any version derived
+// from git and, given a platform matrix, with the default executable named for each platform.
+func bundledManifest(p *project, manifest *model.Manifest, manifestPath string) ([]byte, error) {
+	data, err := versionedManifest(manifestPath, manifest.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.HasServer() && p.Platforms != nil {
+		data, err = setManifestExecutables(data, manifestFormat(manifestPath), p.Platforms)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to set executables in %s", manifestPath)
+		}
+	}
+
+	return data, nil
+}
+
+// verifyBundleEntries checks that every executable and the webapp bundle named by the manifest
+// are included in the bundle, and that each platform's executable is built for that platform.
+func verifyBundleEntries(manifest *model.Manifest, manifestPath string, entries []bundleEntry) error {
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Source != "" {
+			files[entry.Name] = entry.Source
+		}
+	}
+
+	var missing []string
+	checked := make(map[string]bool)
+	check := func(name string) string {
+		name = path.Clean(filepath.ToSlash(name))
+		if !checked[name] {
+			checked[name] = true
+			if files[name] == "" {
+				missing = append(missing, name)
+			}
+		}
+		return files[name]
+	}
+
+	var mismatched []string
+	if manifest.HasServer() {
+		// The executables are those named by the bundled copy of the manifest.
+		var data []byte
+		for _, entry := range entries {
+			if entry.Name == "plugin."+manifestFormat(manifestPath) {
+				data = entry.Content
+			}
+		}
+		if data == nil {
+			var err error
+			if data, err = ioutil.ReadFile(manifestPath); err != nil {
+				return errors.Wrapf(err, "failed to read %s", manifestPath)
+			}
+		}
+		executables, fallback, err := manifestExecutables(data, manifestFormat(manifestPath))
+		if err != nil {
+			return errors.Wrapf(err, "failed to read executables from %s", manifestPath)
+		}
+
+		platforms := make([]string, 0, len(executables))
+		for platform := range executables {
+			platforms = append(platforms, platform)
+		}
+		sort.Strings(platforms)
+
+		for _, name := range platforms {
+			source := check(executables[name])
+			platform, err := parsePlatform(name)
+			if err != nil || source == "" {
+				// Leave unknown platforms to the server, which ignores them.
+				continue
+			}
+			if err := verifyExecutable(source, platform); err != nil {
+				mismatched = append(mismatched, err.Error())
+			}
+		}
+		if fallback != "" {
+			check(fallback)
+		}
+	}
+	if manifest.HasWebapp() {
+		check(manifest.Webapp.BundlePath)
+	}
+
+	if len(missing) > 0 {
+		return errors.Errorf("bundle is missing files named in the manifest: %v", missing)
+	}
+	if len(mismatched) > 0 {
+		return errors.Errorf("bundle contains executables built for the wrong platform: %s", strings.Join(mismatched, "; "))
+	}
+
+	return nil
+}
+
+// writeBundle writes the entries as a gzipped tar rooted at a directory named after the plugin
+// id. Timestamps, owners and modes are normalised so that the same inputs always produce the
+// same archive.
+func writeBundle(w io.Writer, pluginId string, entries []bundleEntry) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	rootHeader := &tar.Header{
+		Name:     pluginId + "/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+		ModTime:  time.Unix(0, 0),
+	}
+	if err := tarWriter.WriteHeader(rootHeader); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    path.Join(pluginId, entry.Name),
+			Mode:    entry.Mode,
+			ModTime: time.Unix(0, 0),
+		}
+		if entry.Source == "" {
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = entry.Size
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if entry.Source == "" {
+			continue
+		}
+		if err := copyBundleFile(tarWriter, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+
+	return gzipWriter.Close()
+}
+
+func copyBundleFile(w io.Writer, entry bundleEntry) error {
+	if entry.Content != nil {
+		_, err := w.Write(entry.Content)
+		return err
+	}
+
+	file, err := os.Open(entry.Source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.CopyN(w, file, entry.Size); err != nil {
+		return errors.Wrapf(err, "failed to copy %s", entry.Source)
+	}
+
+	return nil
+}
+
+// manifestNames are the manifest file names the server looks for, in order of preference.
+var manifestNames = []string{"plugin.yml", "plugin.yaml", "plugin.json"}
+
+// bundleManifest is the manifest found inside a plugin bundle.
+type bundleManifest struct {
+	Manifest *model.Manifest
+	// Name is the path of the manifest within the archive.
+	Name string
+	// Data is the manifest exactly as stored in the archive.
+	Data []byte
+}
+
+// readBundleManifest locates the manifest at the root of the bundle or in its top-level
+// directory, and strictly decodes it as findManifest does.
+func readBundleManifest(bundlePath string) (*bundleManifest, error) {
+	found := make(map[string]*bundleManifest)
+	err := walkBundle(bundlePath, func(header *tar.Header, r io.Reader) error {
+		name := strings.TrimPrefix(path.Clean(header.Name), "./")
+		if header.Typeflag != tar.TypeReg || strings.Count(name, "/") > 1 {
+			return nil
+		}
+
+		base := path.Base(name)
+		for _, manifestName := range manifestNames {
+			if base != manifestName || found[base] != nil {
+				continue
+			}
+
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read %s", name)
+			}
+			found[base] = &bundleManifest{Name: name, Data: data}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, manifestName := range manifestNames {
+		result := found[manifestName]
+		if result == nil {
+			continue
+		}
+
+		manifest, err := decodeManifest(bytes.NewReader(result.Data), manifestFormat(manifestName), true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s in %s", result.Name, bundlePath)
+		}
+		result.Manifest = manifest
+
+		return result, nil
+	}
+
+	return nil, errors.Errorf("no manifest found in %s", bundlePath)
+}
+
+// walkBundle calls fn for each entry in the gzipped tar at bundlePath, with a reader for the
+// entry's content.
+func walkBundle(bundlePath string, fn func(header *tar.Header, r io.Reader) error) error {
+	bundleFile, err := os.Open(bundlePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", bundlePath)
+	}
+	defer bundleFile.Close()
+
+	gzipReader, err := gzip.NewReader(bundleFile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", bundlePath)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", bundlePath)
+		}
+
+		if err := fn(header, tarReader); err != nil {
+			return errors.Wrapf(err, "failed to read %s", bundlePath)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+func TestBundlePluginIsReproducible(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"plugin.json":         `{"id": "com.example.test", "version": "0.1.0", "webapp": {"bundle_path": "webapp/dist/main.js"}}`,
+		"webapp/dist/main.js": "console.log('test');\n",
+		"webapp/dist/a.css":   "body {}\n",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := newProject()
+	p.Root = dir
+	manifest := &model.Manifest{Id: "com.example.test", Version: "0.1.0", Webapp: &model.ManifestWebapp{BundlePath: "webapp/dist/main.js"}}
+	manifestPath := filepath.Join(dir, "plugin.json")
+
+	bundle := func(name string) ([]byte, string) {
+		bundlePath := filepath.Join(dir, name, "bundle.tar.gz")
+		if err := bundlePlugin(p, manifest, manifestPath, bundlePath); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(bundlePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checksum, err := ioutil.ReadFile(bundlePath + ".sha256")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data, string(checksum)
+	}
+
+	first, firstChecksum := bundle("first")
+
+	// Neither timestamps nor permissions beyond the executable bit may leak into the bundle.
+	later := time.Now().Add(time.Hour)
+	for name := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.Chtimes(name, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(name, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	second, secondChecksum := bundle("second")
+
+	if !bytes.Equal(first, second) {
+		t.Error("bundling the same files twice produced different archives")
+	}
+	if firstChecksum != secondChecksum {
+		t.Errorf("expected checksum %q, got %q", firstChecksum, secondChecksum)
+	}
+	if !strings.HasSuffix(firstChecksum, "  bundle.tar.gz\n") {
+		t.Errorf("checksum %q does not name the bundle", firstChecksum)
+	}
+}
+
+func TestBundlePluginMissingWebapp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, "plugin.json")
+	if err := ioutil.WriteFile(manifestPath, []byte(`{"id": "com.example.test"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "webapp", "dist"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newProject()
+	p.Root = dir
+	manifest := &model.Manifest{Id: "com.example.test", Webapp: &model.ManifestWebapp{BundlePath: "webapp/dist/main.js"}}
+	err = bundlePlugin(p, manifest, manifestPath, filepath.Join(dir, "dist", "bundle.tar.gz"))
+	if err == nil || !strings.Contains(err.Error(), "webapp/dist/main.js") {
+		t.Fatalf("expected missing webapp bundle error, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// compatResult describes whether a manifest can be installed on a given server version.
+type compatResult struct {
+	ServerVersion    string   `json:"server_version"`
+	MinServerVersion string   `json:"min_server_version,omitempty"`
+	Compatible       bool     `json:"compatible"`
+	Warnings         []string `json:"warnings,omitempty"`
+}
+
+// queryServerVersion asks the server at siteURL for its version, using the unauthenticated
+// client config endpoint and falling back to the version header returned by ping.
+func queryServerVersion(siteURL string) (string, error) {
+	client := model.NewAPIv4Client(siteURL)
+
+	if config, resp := client.GetOldClientConfig(""); resp.Error == nil && config["Version"] != "" {
+		return config["Version"], nil
+	}
+
+	_, resp := client.GetPing()
+	if resp.Error != nil {
+		return "", errors.Wrapf(resp.Error, "failed to ping %s", siteURL)
+	}
+
+	// The version header is of the form 5.6.0.5.6.0.<hash>.<enterprise>, led by the version.
+	parts := strings.SplitN(resp.ServerVersion, ".", 4)
+	if len(parts) < 3 {
+		return "", errors.Errorf("server at %s did not report its version", siteURL)
+	}
+
+	return strings.Join(parts[:3], "."), nil
+}
+
+// checkCompat reports whether the manifest's min_server_version is satisfied by serverVersion.
+// An unparseable serverVersion is a usage error, while an unparseable min_server_version is a
+// manifest error.
+//
+// When no min_server_version is set, it warns about any settings types and manifest fields in
+// use that the vendored server model doesn't know, since older servers will reject or ignore them.
+func checkCompat(manifest *model.Manifest, manifestPath, serverVersion string) (*compatResult, error) {
+	version, err := semver.ParseTolerant(serverVersion)
+	if err != nil {
+		return nil, withExitCode(exitUsage, errors.Wrapf(err, "failed to parse server version %s", serverVersion))
+	}
+
+	result := &compatResult{
+		ServerVersion:    version.String(),
+		MinServerVersion: manifest.MinServerVersion,
+		Compatible:       true,
+	}
+
+	if manifest.MinServerVersion != "" {
+		result.Compatible, err = manifest.MeetMinServerVersion(result.ServerVersion)
+		if err != nil {
+			return nil, withExitCode(exitManifest, errors.Wrapf(err, "failed to parse min_server_version %s", manifest.MinServerVersion))
+		}
+
+		return result, nil
+	}
+
+	unknownFields, err := unknownManifestFields(manifestPath)
+	if err != nil {
+		return nil, withExitCode(exitManifest, err)
+	}
+	for _, field := range unknownFields {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"min_server_version is not set, but %s is not supported by server model %s",
+			field, model.CurrentVersion,
+		))
+	}
+
+	if manifest.SettingsSchema != nil {
+		for i, setting := range manifest.SettingsSchema.Settings {
+			if setting != nil && !settingTypes[setting.Type] {
+				result.Warnings = append(result.Warnings, fmt.Sprintf(
+					"min_server_version is not set, but settings_schema.settings[%d] uses type %q which is not supported by server model %s",
+					i, setting.Type, model.CurrentVersion,
+				))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// unknownManifestFields returns the JSON paths of any fields in the manifest file that
+// model.Manifest doesn't define.
+func unknownManifestFields(manifestPath string) ([]string, error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", manifestPath)
+	}
+
+	raw, err := parseManifestDocument(data, manifestFormat(manifestPath))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", manifestPath)
+	}
+
+	var unknown []string
+	collectUnknownFields("", raw, reflect.TypeOf(model.Manifest{}), &unknown)
+	sort.Strings(unknown)
+
+	return unknown, nil
+}
+
+func collectUnknownFields(path string, raw interface{}, t reflect.Type, unknown *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch value := raw.(type) {
+	case yaml.MapSlice:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+
+		for _, item := range value {
+			name, child := fmt.Sprint(item.Key), item.Value
+			childPath := name
+			if path != "" {
+				childPath = path + "." + name
+			}
+
+			fieldType, ok := fields[name]
+			if !ok {
+				*unknown = append(*unknown, childPath)
+				continue
+			}
+			collectUnknownFields(childPath, child, fieldType, unknown)
+		}
+
+	case []interface{}:
+		if t.Kind() != reflect.Slice {
+			return
+		}
+		for i, child := range value {
+			collectUnknownFields(fmt.Sprintf("%s[%d]", path, i), child, t.Elem(), unknown)
+		}
+	}
+}
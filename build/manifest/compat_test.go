@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+func TestCheckCompat(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		minServerVersion string
+		serverVersion    string
+		expected         bool
+		code             int
+		err              string
+	}{
+		{"below the minimum", "5.6.0", "5.5.1", false, 0, ""},
+		{"equal to the minimum", "5.6.0", "5.6.0", true, 0, ""},
+		{"above the minimum", "5.6.0", "5.12.0", true, 0, ""},
+		{"tolerant server version", "5.6.0", "v5.6", true, 0, ""},
+		{"unparseable server version", "5.6.0", "latest", false, exitUsage, "failed to parse server version latest"},
+		{"unparseable min_server_version", "5.6", "5.6.0", false, exitManifest, "failed to parse min_server_version 5.6"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			manifest := &model.Manifest{Id: "com.example.test", MinServerVersion: test.minServerVersion}
+
+			result, err := checkCompat(manifest, "plugin.json", test.serverVersion)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				if code := exitCode(err); code != test.code {
+					t.Errorf("expected exit code %d, got %d", test.code, code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Compatible != test.expected {
+				t.Errorf("expected compatible %t, got %t", test.expected, result.Compatible)
+			}
+			if len(result.Warnings) > 0 {
+				t.Errorf("expected no warnings with min_server_version set, got %v", result.Warnings)
+			}
+		})
+	}
+}
+
+func TestCheckCompatWarnings(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		file     string
+		data     string
+		settings []*model.PluginSetting
+		expected []string
+		err      string
+	}{
+		{
+			name: "known fields",
+			file: "plugin.json",
+			data: `{"id": "com.example.test", "description": "Reads and\/or writes", "settings_schema": {"settings": [{"key": "Name", "type": "text"}]}}`,
+		},
+		{
+			name: "unknown json fields",
+			file: "plugin.json",
+			data: `{"id": "com.example.test", "icon_path": "assets\/icon.svg", "settings_schema": {"settings": [{"key": "Name", "type": "text", "hosting": "cloud"}]}}`,
+			expected: []string{
+				"icon_path is not supported",
+				"settings_schema.settings[0].hosting is not supported",
+			},
+		},
+		{
+			name: "unknown yaml fields",
+			file: "plugin.yaml",
+			data: "id: com.example.test\nserver:\n  executables:\n    linux-amd64: server/dist/plugin-linux-amd64\n    linux-arm64: server/dist/plugin-linux-arm64\n",
+			expected: []string{
+				"server.executables.linux-arm64 is not supported",
+			},
+		},
+		{
+			name:     "unknown settings type",
+			file:     "plugin.json",
+			data:     `{"id": "com.example.test", "settings_schema": {"settings": [{"key": "Token", "type": "custom"}]}}`,
+			settings: []*model.PluginSetting{{Key: "Token", Type: "custom"}},
+			expected: []string{
+				`settings_schema.settings[0] uses type "custom" which is not supported`,
+			},
+		},
+		{
+			name: "invalid manifest",
+			file: "plugin.json",
+			data: `{"id": "com.example.test"`,
+			err:  "failed to parse",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "compat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			manifestPath := filepath.Join(dir, test.file)
+			if err := ioutil.WriteFile(manifestPath, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			manifest := &model.Manifest{
+				Id:             "com.example.test",
+				SettingsSchema: &model.PluginSettingsSchema{Settings: test.settings},
+			}
+
+			result, err := checkCompat(manifest, manifestPath, "5.6.0")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				if code := exitCode(err); code != exitManifest {
+					t.Errorf("expected exit code %d, got %d", exitManifest, code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Compatible {
+				t.Error("expected a manifest without min_server_version to be compatible")
+			}
+
+			if len(result.Warnings) != len(test.expected) {
+				t.Fatalf("expected warnings containing %q, got %q", test.expected, result.Warnings)
+			}
+			for i, warning := range result.Warnings {
+				if !strings.Contains(warning, test.expected[i]) {
+					t.Errorf("expected warning containing %q, got %q", test.expected[i], warning)
+				}
+			}
+		})
+	}
+}
+
+func TestParseManifestDocument(t *testing.T) {
+	document, err := parseManifestDocument([]byte(`{"id": "com.example.test", "homepage_url": "https:\/\/example.com", "server": {"executables": {"linux-amd64": "a", "darwin-amd64": "b"}}}`), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []interface{}
+	for _, item := range document {
+		keys = append(keys, item.Key)
+	}
+	if expected := []interface{}{"id", "homepage_url", "server"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+	if url := document[1].Value; url != "https://example.com" {
+		t.Errorf("expected unescaped homepage_url, got %v", url)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// generatedSettingLength matches the length of values the System Console generates.
+const generatedSettingLength = 32
+
+// configFragment is the subset of a Mattermost config.json that installs and enables the plugin.
+type configFragment struct {
+	PluginSettings struct {
+		Plugins      map[string]map[string]interface{}
+		PluginStates map[string]*model.PluginState
+	}
+}
+
+// renderConfig renders a config.json fragment enabling the plugin with its default settings,
+// adjusted by the given KEY=VALUE overrides. Generated settings are given random values unless
+// overridden.
+func renderConfig(manifest *model.Manifest, overrides []string) ([]byte, error) {
+	var settings []*model.PluginSetting
+	if manifest.SettingsSchema != nil {
+		settings = manifest.SettingsSchema.Settings
+	}
+
+	values := make(map[string]interface{})
+	for _, setting := range settings {
+		if setting == nil {
+			continue
+		}
+
+		// The server lowercases plugin setting keys when it loads the configuration.
+		key := strings.ToLower(setting.Key)
+		if setting.Type == "generated" {
+			values[key] = model.NewRandomString(generatedSettingLength)
+		} else {
+			values[key] = setting.Default
+		}
+	}
+
+	for _, override := range overrides {
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid override %s, expected KEY=VALUE", override)
+		}
+
+		setting := findSetting(settings, parts[0])
+		if setting == nil {
+			return nil, errors.Errorf("unknown setting %s", parts[0])
+		}
+
+		value, err := parseSettingValue(setting, parts[1])
+		if err != nil {
+			return nil, err
+		}
+		values[strings.ToLower(setting.Key)] = value
+	}
+
+	var fragment configFragment
+	fragment.PluginSettings.Plugins = map[string]map[string]interface{}{manifest.Id: values}
+	fragment.PluginSettings.PluginStates = map[string]*model.PluginState{manifest.Id: {Enable: true}}
+
+	data, err := json.MarshalIndent(fragment, "", "    ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal config")
+	}
+
+	return append(data, '\n'), nil
+}
+
+// findSetting returns the setting with the given key, ignoring case as the server does.
+func findSetting(settings []*model.PluginSetting, key string) *model.PluginSetting {
+	for _, setting := range settings {
+		if setting != nil && strings.EqualFold(setting.Key, key) {
+			return setting
+		}
+	}
+
+	return nil
+}
+
+// parseSettingValue converts the raw value into the type expected by the setting, rejecting
+// values outside of the options of dropdown and radio settings.
+func parseSettingValue(setting *model.PluginSetting, raw string) (interface{}, error) {
+	switch setting.Type {
+	case "bool":
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.Errorf("%s must be true or false, got %s", setting.Key, raw)
+		}
+		return value, nil
+
+	case "dropdown", "radio":
+		var allowed []string
+		for _, option := range setting.Options {
+			if option == nil {
+				continue
+			}
+			if option.Value == raw {
+				return raw, nil
+			}
+			allowed = append(allowed, option.Value)
+		}
+		return nil, errors.Errorf("%s must be one of %s, got %s", setting.Key, strings.Join(allowed, ", "), raw)
+
+	case "text", "longtext", "generated", "username":
+		return raw, nil
+
+	default:
+		return nil, errors.Errorf("setting %s has unsupported type %q", setting.Key, setting.Type)
+	}
+}
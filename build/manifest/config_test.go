@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+var configManifest = &model.Manifest{
+	Id: "com.example.test",
+	SettingsSchema: &model.PluginSettingsSchema{
+		Settings: []*model.PluginSetting{
+			{Key: "Enabled", Type: "bool", Default: true},
+			{Key: "SiteHost", Type: "text", Default: "example.com"},
+			{Key: "Secret", Type: "generated"},
+			{Key: "Mode", Type: "radio", Default: "fast", Options: []*model.PluginOption{{Value: "fast"}, {Value: "slow"}}},
+			nil,
+		},
+	},
+}
+
+func TestRenderConfig(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		overrides []string
+		golden    string
+		err       string
+	}{
+		{name: "defaults", overrides: []string{"secret=fixed"}, golden: "config_defaults.json"},
+		{
+			name:      "overrides ignore case",
+			overrides: []string{"Secret=fixed", "enabled=false", "SITEHOST=a=b", "mode=slow"},
+			golden:    "config_overrides.json",
+		},
+		{name: "missing value", overrides: []string{"enabled"}, err: "invalid override enabled, expected KEY=VALUE"},
+		{name: "unknown setting", overrides: []string{"color=red"}, err: "unknown setting color"},
+		{name: "invalid bool", overrides: []string{"enabled=yes"}, err: "Enabled must be true or false, got yes"},
+		{name: "invalid option", overrides: []string{"mode=medium"}, err: "Mode must be one of fast, slow, got medium"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := renderConfig(configManifest, test.overrides)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test.golden, data)
+		})
+	}
+}
+
+func TestRenderConfigGeneratesSecrets(t *testing.T) {
+	var fragments [2]configFragment
+	for i := range fragments {
+		data, err := renderConfig(configManifest, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &fragments[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, _ := fragments[0].PluginSettings.Plugins["com.example.test"]["secret"].(string)
+	second, _ := fragments[1].PluginSettings.Plugins["com.example.test"]["secret"].(string)
+	if len(first) != generatedSettingLength || len(second) != generatedSettingLength {
+		t.Errorf("expected generated secrets of length %d, got %q and %q", generatedSettingLength, first, second)
+	}
+	if first == second {
+		t.Errorf("expected a new secret each time, got %q twice", first)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+const configurationGoFileTemplate = `// Code generated by build/manifest from the plugin manifest. DO NOT EDIT.
+
+package main
+{{if .HasOptions}}
+import (
+	"fmt"
+)
+{{end}}
+// configuration captures the plugin's external configuration as exposed in the Mattermost server
+// configuration, with one field per setting in the manifest's settings_schema.
+type configuration struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`json:\"{{.Key}}\"`" + `
+{{- end}}
+}
+
+// Clone shallow copies the configuration. Your implementation may require a deep copy if
+// your configuration has reference types.
+func (c *configuration) Clone() *configuration {
+	var clone = *c
+	return &clone
+}
+
+// SetDefaults resets every setting to the default declared in the manifest. Call it before
+// loading the plugin configuration so that settings absent from the server config keep their defaults.
+func (c *configuration) SetDefaults() {
+{{- range .Fields}}
+	c.{{.Name}} = {{.Default}}
+{{- end}}
+}
+
+// IsValid checks that every dropdown and radio setting holds one of its declared options, or is
+// unset if the manifest declares no default for it.
+func (c *configuration) IsValid() error {
+{{- range .Fields}}{{if .Options}}
+	switch c.{{.Name}} {
+	case {{join .Options ", "}}:
+	default:
+		return fmt.Errorf("%q is not a valid value for {{.Key}}", c.{{.Name}})
+	}
+{{end}}{{end}}
+	return nil
+}
+`
+
+var configurationGoTemplate = template.Must(template.New("configuration").
+	Funcs(template.FuncMap{"join": strings.Join}).
+	Parse(configurationGoFileTemplate))
+
+// configurationField describes a single generated configuration struct field.
+type configurationField struct {
+	Key     string
+	Name    string
+	Type    string
+	Default string
+	Options []string
+}
+
+// generateConfiguration renders a Go configuration struct mirroring the manifest's settings schema.
+func generateConfiguration(manifest *model.Manifest) ([]byte, error) {
+	data := struct {
+		Fields     []configurationField
+		HasOptions bool
+	}{}
+
+	if manifest.SettingsSchema != nil {
+		// Fields can't share a name with the methods generated on the struct, reserved here
+		// without a setting key.
+		names := map[string]string{"Clone": "", "SetDefaults": "", "IsValid": ""}
+		for _, setting := range manifest.SettingsSchema.Settings {
+			if setting == nil {
+				continue
+			}
+
+			field, err := newConfigurationField(setting)
+			if err != nil {
+				return nil, err
+			}
+			if other, ok := names[field.Name]; ok && other == "" {
+				return nil, errors.Errorf("setting %s maps to configuration field %s, which clashes with the generated method", setting.Key, field.Name)
+			} else if ok {
+				return nil, errors.Errorf("settings %s and %s both map to configuration field %s", other, setting.Key, field.Name)
+			}
+			names[field.Name] = setting.Key
+
+			data.Fields = append(data.Fields, field)
+			data.HasOptions = data.HasOptions || len(field.Options) > 0
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := configurationGoTemplate.Execute(&buf, data); err != nil {
+		return nil, errors.Wrap(err, "failed to render configuration")
+	}
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to format configuration")
+	}
+
+	return source, nil
+}
+
+func newConfigurationField(setting *model.PluginSetting) (configurationField, error) {
+	field := configurationField{
+		Key:  setting.Key,
+		Name: exportedName(setting.Key),
+	}
+	if field.Name == "" {
+		return field, errors.Errorf("setting key %q cannot be used as a Go identifier", setting.Key)
+	}
+
+	switch setting.Type {
+	case "bool":
+		field.Type = "bool"
+		field.Default = "false"
+		if setting.Default != nil {
+			value, ok := setting.Default.(bool)
+			if !ok {
+				return field, errors.Errorf("default for bool setting %s must be a boolean", setting.Key)
+			}
+			if value {
+				field.Default = "true"
+			}
+		}
+
+	case "text", "longtext", "generated", "username", "dropdown", "radio":
+		field.Type = "string"
+		field.Default = `""`
+		if setting.Default != nil {
+			value, ok := setting.Default.(string)
+			if !ok {
+				return field, errors.Errorf("default for %s setting %s must be a string", setting.Type, setting.Key)
+			}
+			field.Default = strconv.Quote(value)
+		}
+
+		if setting.Type == "dropdown" || setting.Type == "radio" {
+			values := make(map[string]bool)
+			for _, option := range setting.Options {
+				if option == nil {
+					continue
+				}
+				if values[option.Value] {
+					return field, errors.Errorf("setting %s lists option %q more than once", setting.Key, option.Value)
+				}
+				values[option.Value] = true
+				field.Options = append(field.Options, strconv.Quote(option.Value))
+			}
+
+			// Without a default, SetDefaults leaves the setting empty until an admin chooses.
+			if setting.Default == nil && !values[""] {
+				field.Options = append(field.Options, `""`)
+			}
+		}
+
+	default:
+		return field, errors.Errorf("setting %s has unsupported type %q", setting.Key, setting.Type)
+	}
+
+	return field, nil
+}
+
+// exportedName converts a setting key such as "site_host" or "siteHost" into an exported Go
+// identifier such as "SiteHost", returning an empty string if no identifier can be formed.
+func exportedName(key string) string {
+	var name strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if name.Len() == 0 && unicode.IsDigit(r) {
+			name.WriteString("Setting")
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		name.WriteRune(r)
+	}
+
+	return name.String()
+}
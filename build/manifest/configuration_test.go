@@ -0,0 +1,125 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+func TestGenerateConfiguration(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		settings []*model.PluginSetting
+		contains []string
+		err      string
+	}{
+		{
+			name:     "no settings",
+			contains: []string{"type configuration struct {\n}"},
+		},
+		{
+			name: "bool and text defaults",
+			settings: []*model.PluginSetting{
+				{Key: "Enabled", Type: "bool", Default: true},
+				{Key: "site_host", Type: "text", Default: "example.com"},
+				{Key: "secret", Type: "generated"},
+			},
+			contains: []string{
+				"Enabled  bool   `json:\"Enabled\"`",
+				"SiteHost string `json:\"site_host\"`",
+				"c.Enabled = true",
+				`c.SiteHost = "example.com"`,
+				`c.Secret = ""`,
+			},
+		},
+		{
+			name: "dropdown with default",
+			settings: []*model.PluginSetting{
+				{Key: "Mode", Type: "dropdown", Default: "a", Options: []*model.PluginOption{{Value: "a"}, {Value: "b"}}},
+			},
+			contains: []string{`case "a", "b":`},
+		},
+		{
+			name: "radio without default accepts the empty value",
+			settings: []*model.PluginSetting{
+				{Key: "Mode", Type: "radio", Options: []*model.PluginOption{{Value: "a"}, {Value: "b"}}},
+			},
+			contains: []string{`c.Mode = ""`, `case "a", "b", "":`},
+		},
+		{
+			name: "duplicate option values",
+			settings: []*model.PluginSetting{
+				{Key: "Mode", Type: "dropdown", Default: "a", Options: []*model.PluginOption{{Value: "a"}, {Value: "a"}}},
+			},
+			err: `setting Mode lists option "a" more than once`,
+		},
+		{
+			name:     "mistyped default",
+			settings: []*model.PluginSetting{{Key: "Enabled", Type: "bool", Default: "yes"}},
+			err:      "default for bool setting Enabled must be a boolean",
+		},
+		{
+			name:     "unsupported type",
+			settings: []*model.PluginSetting{{Key: "Color", Type: "color"}},
+			err:      `setting Color has unsupported type "color"`,
+		},
+		{
+			name:     "colliding field names",
+			settings: []*model.PluginSetting{{Key: "site_host", Type: "text"}, {Key: "SiteHost", Type: "text"}},
+			err:      "settings site_host and SiteHost both map to configuration field SiteHost",
+		},
+		{
+			name:     "field named after a generated method",
+			settings: []*model.PluginSetting{{Key: "is_valid", Type: "bool"}},
+			err:      "setting is_valid maps to configuration field IsValid, which clashes with the generated method",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			manifest := &model.Manifest{Id: "com.example.test"}
+			if test.settings != nil {
+				manifest.SettingsSchema = &model.PluginSettingsSchema{Settings: test.settings}
+			}
+
+			source, err := generateConfiguration(manifest)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, expected := range test.contains {
+				if !strings.Contains(string(source), expected) {
+					t.Errorf("expected generated source to contain %q:\n%s", expected, source)
+				}
+			}
+			typeCheck(t, string(source))
+		})
+	}
+}
+
+// typeCheck fails the test unless source compiles, catching problems such as duplicate switch
+// cases that formatting alone does not.
+func typeCheck(t *testing.T, source string) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "configuration_gen.go", source, 0)
+	if err != nil {
+		t.Fatalf("failed to parse generated source: %v", err)
+	}
+
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := config.Check("main", fset, []*ast.File{file}, nil); err != nil {
+		t.Fatalf("generated source does not compile: %v\n%s", err, source)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// deployConfig describes the server to deploy to and the credentials to use. Either a personal
+// access token or a username and password is required.
+type deployConfig struct {
+	SiteURL  string
+	Username string
+	Password string
+	Token    string
+}
+
+// deployConfigFromEnv reads the deploy configuration from the environment variables also
+// consulted by the Makefile.
+func deployConfigFromEnv() deployConfig {
+	return deployConfig{
+		SiteURL:  os.Getenv("MM_SERVICESETTINGS_SITEURL"),
+		Username: os.Getenv("MM_ADMIN_USERNAME"),
+		Password: os.Getenv("MM_ADMIN_PASSWORD"),
+		Token:    os.Getenv("MM_ADMIN_TOKEN"),
+	}
+}
+
+// deployPlugin replaces any installed copy of the plugin on the configured server with the
+// given bundle, and enables it. The installed copy is only removed before uploading if the
+// server can't replace it in place.
+func deployPlugin(config deployConfig, pluginId, bundlePath string) error {
+	if config.SiteURL == "" {
+		return errors.New("no site url configured, set MM_SERVICESETTINGS_SITEURL")
+	}
+
+	client := model.NewAPIv4Client(config.SiteURL)
+	loggedIn, err := deployLogin(client, config)
+	if err != nil {
+		return err
+	}
+	if loggedIn {
+		defer client.Logout()
+	}
+
+	bundle, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", bundlePath)
+	}
+
+	// Servers that support forced uploads replace the installed plugin in place. Older servers
+	// reject the upload instead, leaving no choice but to remove the installed plugin first.
+	manifest, resp := uploadPluginForced(client, bundle)
+	if resp.Error != nil && resp.Error.Id == "app.plugin.install_id.app_error" {
+		if _, resp := client.RemovePlugin(pluginId); resp.Error != nil && !isPluginNotInstalled(resp) {
+			return errors.Wrapf(resp.Error, "failed to remove existing plugin %s", pluginId)
+		}
+
+		manifest, resp = client.UploadPlugin(bytes.NewReader(bundle))
+		if resp.Error != nil {
+			return errors.Wrapf(resp.Error, "failed to upload %s after removing the installed version of %s", bundlePath, pluginId)
+		}
+	} else if resp.Error != nil {
+		return errors.Wrapf(resp.Error, "failed to upload %s", bundlePath)
+	}
+	if manifest != nil && manifest.Id != pluginId {
+		return errors.Errorf("uploaded bundle contains plugin %s, expected %s", manifest.Id, pluginId)
+	}
+
+	if _, resp := client.EnablePlugin(pluginId); resp.Error != nil {
+		return errors.Wrapf(resp.Error, "failed to enable plugin %s", pluginId)
+	}
+
+	return nil
+}
+
+// deployLogin authenticates the client, preferring a personal access token over a username and
+// password. It reports whether a session was created that should be logged out afterwards.
+func deployLogin(client *model.Client4, config deployConfig) (bool, error) {
+	if config.Token != "" {
+		client.MockSession(config.Token)
+		if _, resp := client.GetMe(""); resp.Error != nil {
+			return false, errors.Wrap(resp.Error, "failed to authenticate with access token")
+		}
+
+		return false, nil
+	}
+
+	if config.Username == "" || config.Password == "" {
+		return false, errors.New("no credentials configured, set MM_ADMIN_TOKEN or MM_ADMIN_USERNAME and MM_ADMIN_PASSWORD")
+	}
+
+	if _, resp := client.Login(config.Username, config.Password); resp.Error != nil {
+		return false, errors.Wrapf(resp.Error, "failed to log in as %s", config.Username)
+	}
+
+	return true, nil
+}
+
+// uploadPluginForced uploads the bundle as model.Client4.UploadPlugin does, but asks the server
+// to replace any installed copy of the plugin. The vendored client predates the force option.
+func uploadPluginForced(client *model.Client4, bundle []byte) (*model.Manifest, *model.Response) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("plugin", "plugin.tar.gz")
+	if err == nil {
+		_, err = part.Write(bundle)
+	}
+	if err == nil {
+		err = writer.WriteField("force", "true")
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return nil, &model.Response{Error: model.NewAppError("uploadPluginForced", "model.client.writer.app_error", nil, err.Error(), 0)}
+	}
+
+	request, err := http.NewRequest(http.MethodPost, client.ApiUrl+client.GetPluginsRoute(), body)
+	if err != nil {
+		return nil, &model.Response{Error: model.NewAppError("uploadPluginForced", "model.client.connecting.app_error", nil, err.Error(), 0)}
+	}
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	if client.AuthToken != "" {
+		request.Header.Set(model.HEADER_AUTH, client.AuthType+" "+client.AuthToken)
+	}
+
+	response, err := client.HttpClient.Do(request)
+	if err != nil {
+		return nil, &model.Response{Error: model.NewAppError("uploadPluginForced", "model.client.connecting.app_error", nil, err.Error(), 0)}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return nil, model.BuildErrorResponse(response, model.AppErrorFromJson(response.Body))
+	}
+
+	return model.ManifestFromJson(response.Body), model.BuildResponse(response)
+}
+
+// isPluginNotInstalled reports whether a failed removal only failed because there was nothing
+// to remove.
+func isPluginNotInstalled(resp *model.Response) bool {
+	return resp.StatusCode == http.StatusNotFound || resp.Error.Id == "app.plugin.not_installed.app_error"
+}
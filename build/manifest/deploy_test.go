@@ -0,0 +1,224 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// deployStub answers the requests made by deployPlugin, recording each as "METHOD path". A
+// forced upload replaces an installed plugin only if the stub supports forcing.
+type deployStub struct {
+	token        string
+	installed    bool
+	supportForce bool
+	uploadedId   string
+	uploadError  bool
+	enableError  bool
+	requests     []string
+}
+
+func (s *deployStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v4")
+	s.requests = append(s.requests, r.Method+" "+path)
+
+	fail := func(id string, status int) {
+		w.WriteHeader(status)
+		w.Write([]byte(model.NewAppError("stub", id, nil, "", status).ToJson()))
+	}
+	ok := func() {
+		w.Write([]byte(`{"status": "OK"}`))
+	}
+
+	if path == "/users/login" {
+		props := model.MapFromJson(r.Body)
+		if props["login_id"] != "admin" || props["password"] != "secret" {
+			fail("api.user.login.invalid_credentials", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set(model.HEADER_TOKEN, "session")
+		w.Write([]byte(`{"id": "admin"}`))
+		return
+	}
+
+	auth := r.Header.Get(model.HEADER_AUTH)
+	if auth != model.HEADER_BEARER+" session" && auth != model.HEADER_BEARER+" "+s.token {
+		fail("api.context.session_expired.app_error", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method + " " + path {
+	case "GET /users/me":
+		w.Write([]byte(`{"id": "admin"}`))
+	case "POST /users/logout":
+		ok()
+	case "DELETE /plugins/com.example.test":
+		if !s.installed {
+			fail("app.plugin.not_installed.app_error", http.StatusBadRequest)
+			return
+		}
+		s.installed = false
+		ok()
+	case "POST /plugins":
+		if s.installed && !(s.supportForce && r.FormValue("force") == "true") {
+			fail("app.plugin.install_id.app_error", http.StatusBadRequest)
+			return
+		}
+		if s.uploadError {
+			fail("app.plugin.extract.app_error", http.StatusBadRequest)
+			return
+		}
+		s.installed = true
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "` + s.uploadedId + `"}`))
+	case "POST /plugins/com.example.test/enable":
+		if s.enableError {
+			fail("app.plugin.config.app_error", http.StatusInternalServerError)
+			return
+		}
+		ok()
+	default:
+		fail("api.context.404.app_error", http.StatusNotFound)
+	}
+}
+
+func TestDeployPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundlePath := filepath.Join(dir, "bundle.tar.gz")
+	if err := ioutil.WriteFile(bundlePath, []byte("bundle"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		config   deployConfig
+		stub     deployStub
+		err      string
+		requests []string
+	}{
+		{
+			name:   "token replacing an installed plugin in place",
+			config: deployConfig{Token: "token"},
+			stub:   deployStub{token: "token", installed: true, supportForce: true, uploadedId: "com.example.test"},
+			requests: []string{
+				"GET /users/me",
+				"POST /plugins",
+				"POST /plugins/com.example.test/enable",
+			},
+		},
+		{
+			name:   "token replacing an installed plugin without forced uploads",
+			config: deployConfig{Token: "token"},
+			stub:   deployStub{token: "token", installed: true, uploadedId: "com.example.test"},
+			requests: []string{
+				"GET /users/me",
+				"POST /plugins",
+				"DELETE /plugins/com.example.test",
+				"POST /plugins",
+				"POST /plugins/com.example.test/enable",
+			},
+		},
+		{
+			name:   "password installing a new plugin",
+			config: deployConfig{Username: "admin", Password: "secret"},
+			stub:   deployStub{uploadedId: "com.example.test"},
+			requests: []string{
+				"POST /users/login",
+				"POST /plugins",
+				"POST /plugins/com.example.test/enable",
+				"POST /users/logout",
+			},
+		},
+		{
+			name:     "invalid token",
+			config:   deployConfig{Token: "wrong"},
+			stub:     deployStub{token: "token"},
+			err:      "failed to authenticate with access token",
+			requests: []string{"GET /users/me"},
+		},
+		{
+			name:     "invalid password",
+			config:   deployConfig{Username: "admin", Password: "wrong"},
+			err:      "failed to log in as admin",
+			requests: []string{"POST /users/login"},
+		},
+		{
+			name:   "no credentials",
+			config: deployConfig{},
+			err:    "no credentials configured",
+		},
+		{
+			name:     "upload failure keeps the installed plugin",
+			config:   deployConfig{Token: "token"},
+			stub:     deployStub{token: "token", installed: true, supportForce: true, uploadError: true},
+			err:      "failed to upload",
+			requests: []string{"GET /users/me", "POST /plugins"},
+		},
+		{
+			name:   "upload failure after removing the installed plugin",
+			config: deployConfig{Token: "token"},
+			stub:   deployStub{token: "token", installed: true, uploadError: true},
+			err:    "after removing the installed version of com.example.test",
+			requests: []string{
+				"GET /users/me",
+				"POST /plugins",
+				"DELETE /plugins/com.example.test",
+				"POST /plugins",
+			},
+		},
+		{
+			name:     "bundle for another plugin",
+			config:   deployConfig{Token: "token"},
+			stub:     deployStub{token: "token", uploadedId: "com.example.other"},
+			err:      "uploaded bundle contains plugin com.example.other, expected com.example.test",
+			requests: []string{"GET /users/me", "POST /plugins"},
+		},
+		{
+			name:   "enable failure",
+			config: deployConfig{Token: "token"},
+			stub:   deployStub{token: "token", uploadedId: "com.example.test", enableError: true},
+			err:    "failed to enable plugin com.example.test",
+			requests: []string{
+				"GET /users/me",
+				"POST /plugins",
+				"POST /plugins/com.example.test/enable",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(&test.stub)
+			defer server.Close()
+
+			test.config.SiteURL = server.URL
+			err := deployPlugin(test.config, "com.example.test", bundlePath)
+			if test.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+
+			if !reflect.DeepEqual(test.stub.requests, test.requests) {
+				t.Errorf("expected requests %q, got %q", test.requests, test.stub.requests)
+			}
+		})
+	}
+}
+
+func TestDeployPluginWithoutSiteURL(t *testing.T) {
+	err := deployPlugin(deployConfig{Token: "token"}, "com.example.test", "bundle.tar.gz")
+	if err == nil || !strings.Contains(err.Error(), "no site url configured") {
+		t.Fatalf("expected missing site url error, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+const docsMarkdownTemplate = `# {{title .}} configuration
+{{with .Description}}
+{{.}}
+{{end}}
+- Plugin id: ` + "`{{.Id}}`" + `
+- Version: {{.Version}}
+{{- with .MinServerVersion}}
+- Minimum Mattermost server version: {{.}}
+{{- end}}
+{{with .SettingsSchema}}{{with .Header}}
+{{.}}
+{{end}}
+## Settings
+{{range .Settings}}
+### {{settingName .}}
+
+| Key | Type | Default |
+| --- | --- | --- |
+| ` + "`{{.Key}}`" + ` | {{.Type}} | {{cell (settingDefault .)}} |
+{{if .Options}}
+Allowed values:
+{{range .Options}}
+- ` + "`{{.Value}}`" + `{{with .DisplayName}} ({{.}}){{end}}
+{{- end}}
+{{end}}{{with .HelpText}}
+{{.}}
+{{end}}{{else}}
+This plugin has no settings.
+{{end}}{{with .Footer}}
+{{.}}
+{{end}}{{else}}
+## Settings
+
+This plugin has no settings.
+{{end}}`
+
+const docsHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{title .}} configuration</title>
+</head>
+<body>
+<h1>{{title .}} configuration</h1>
+{{with .Description}}<p>{{.}}</p>
+{{end}}<ul>
+<li>Plugin id: <code>{{.Id}}</code></li>
+<li>Version: {{.Version}}</li>
+{{with .MinServerVersion}}<li>Minimum Mattermost server version: {{.}}</li>
+{{end}}</ul>
+<h2>Settings</h2>
+{{with .SettingsSchema}}{{with .Header}}<p>{{.}}</p>
+{{end}}{{range .Settings}}<h3>{{settingName .}}</h3>
+<table>
+<tr><th>Key</th><th>Type</th><th>Default</th></tr>
+<tr><td><code>{{.Key}}</code></td><td>{{.Type}}</td><td>{{settingDefault .}}</td></tr>
+</table>
+{{if .Options}}<p>Allowed values:</p>
+<ul>
+{{range .Options}}<li><code>{{.Value}}</code>{{with .DisplayName}} ({{.}}){{end}}</li>
+{{end}}</ul>
+{{end}}{{with .HelpText}}<p>{{.}}</p>
+{{end}}{{else}}<p>This plugin has no settings.</p>
+{{end}}{{with .Footer}}<p>{{.}}</p>
+{{end}}{{else}}<p>This plugin has no settings.</p>
+{{end}}</body>
+</html>
+`
+
+var docsFuncs = map[string]interface{}{
+	// cell escapes the pipes separating Markdown table cells.
+	"cell": func(text string) string {
+		return strings.Replace(text, "|", "\\|", -1)
+	},
+	"title": func(manifest *model.Manifest) string {
+		if manifest.Name != "" {
+			return manifest.Name
+		}
+		return manifest.Id
+	},
+	"settingName": func(setting *model.PluginSetting) string {
+		if setting.DisplayName != "" {
+			return setting.DisplayName
+		}
+		return setting.Key
+	},
+	"settingDefault": func(setting *model.PluginSetting) string {
+		switch value := setting.Default.(type) {
+		case nil:
+			if setting.Type == "generated" {
+				return "generated on first use"
+			}
+			return "none"
+		case string:
+			if value == "" {
+				return "empty"
+			}
+			return value
+		default:
+			return fmt.Sprint(value)
+		}
+	},
+}
+
+var (
+	docsMarkdown = template.Must(template.New("markdown").Funcs(docsFuncs).Parse(docsMarkdownTemplate))
+	docsHTML     = htmltemplate.Must(htmltemplate.New("html").Funcs(docsFuncs).Parse(docsHTMLTemplate))
+)
+
+// docsFormat returns the documentation format for the given output path, "html" for .html and
+// .htm files, and "markdown" otherwise.
+func docsFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return "html"
+	default:
+		return "markdown"
+	}
+}
+
+// renderDocs renders admin documentation describing the manifest and every setting in its
+// settings schema.
+func renderDocs(manifest *model.Manifest, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "markdown":
+		err = docsMarkdown.Execute(&buf, manifest)
+	case "html":
+		err = docsHTML.Execute(&buf, manifest)
+	default:
+		return nil, errors.Errorf("unsupported docs format %s", format)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render docs")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// checkDocs reports whether the documentation at path is up to date with the manifest.
+func checkDocs(manifest *model.Manifest, path string) (bool, error) {
+	expected, err := renderDocs(manifest, docsFormat(path))
+	if err != nil {
+		return false, err
+	}
+
+	actual, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	return bytes.Equal(expected, actual), nil
+}
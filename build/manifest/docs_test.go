@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares actual with testdata/name, or rewrites the file with -update.
+func checkGolden(t *testing.T, name string, actual []byte) {
+	t.Helper()
+
+	goldenPath := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(goldenPath, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("%s differs from the output, run go test -update if intended:\n%s", goldenPath, unifiedDiff(goldenPath, "output", expected, actual))
+	}
+}
+
+// docsManifest exercises every part of the documentation templates.
+var docsManifest = &model.Manifest{
+	Id:               "com.example.test",
+	Name:             "Example <Test>",
+	Description:      "Posts examples.",
+	Version:          "1.2.3",
+	MinServerVersion: "5.6.0",
+	SettingsSchema: &model.PluginSettingsSchema{
+		Header: "Configure the plugin.",
+		Footer: "See the website.",
+		Settings: []*model.PluginSetting{
+			{Key: "Enabled", DisplayName: "Enable", Type: "bool", Default: true, HelpText: "Turns it on."},
+			{Key: "Pattern", Type: "text", Default: "a|b"},
+			{Key: "Empty", Type: "text", Default: ""},
+			{Key: "Secret", Type: "generated"},
+			{Key: "Mode", DisplayName: "Mode", Type: "dropdown", Default: "fast", Options: []*model.PluginOption{
+				{DisplayName: "Fast", Value: "fast"},
+				{Value: "slow"},
+			}},
+		},
+	},
+}
+
+func TestRenderDocs(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		manifest *model.Manifest
+		format   string
+		golden   string
+	}{
+		{"markdown", docsManifest, "markdown", "docs.md"},
+		{"html", docsManifest, "html", "docs.html"},
+		{"markdown without settings", &model.Manifest{Id: "com.example.test", Version: "1.2.3"}, "markdown", "docs_no_settings.md"},
+		{"html without settings", &model.Manifest{Id: "com.example.test", Version: "1.2.3"}, "html", "docs_no_settings.html"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			docs, err := renderDocs(test.manifest, test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test.golden, docs)
+		})
+	}
+
+	if _, err := renderDocs(docsManifest, "pdf"); err == nil || err.Error() != "unsupported docs format pdf" {
+		t.Errorf("expected unsupported format error, got %v", err)
+	}
+}
+
+func TestCheckDocs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	docsPath := filepath.Join(dir, "docs.html")
+	docs, err := renderDocs(docsManifest, "html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(docsPath, docs, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if upToDate, err := checkDocs(docsManifest, docsPath); err != nil || !upToDate {
+		t.Errorf("expected freshly rendered docs to be up to date, got %t, %v", upToDate, err)
+	}
+
+	changed := *docsManifest
+	changed.Version = "1.2.4"
+	if upToDate, err := checkDocs(&changed, docsPath); err != nil || upToDate {
+		t.Errorf("expected docs to be out of date after a version change, got %t, %v", upToDate, err)
+	}
+}
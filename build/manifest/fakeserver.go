@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+
+	"github.com/stevepartridge/mattermost-plugin-webex/build/manifest/fakeserver"
+)
+
+// fakePlugin describes a plugin installed on the fake server when it stopped.
+type fakePlugin struct {
+	Id      string `json:"id"`
+	Version string `json:"version"`
+	Enabled bool   `json:"enabled"`
+}
+
+// runFakeServer serves a fake Mattermost server until interrupted or, if a command is given,
+// until the command exits. The command runs with the environment variables consulted by deploy
+// pointing at the fake server, so that `fakeserver -- build/bin/manifest deploy` exercises a
+// deployment offline.
+func runFakeServer(r *reporter, args []string) error {
+	var listen string
+	config := fakeserver.Config{Username: "admin"}
+	fakeFlags := flag.NewFlagSet("fakeserver", flag.ContinueOnError)
+	fakeFlags.SetOutput(ioutil.Discard)
+	fakeFlags.StringVar(&listen, "listen", "", "address to listen on, 127.0.0.1:8065 by default or any free port when running a command")
+	fakeFlags.StringVar(&config.Username, "username", config.Username, "username accepted by login")
+	fakeFlags.StringVar(&config.Password, "password", config.Password, "password accepted by login")
+	fakeFlags.StringVar(&config.Token, "token", config.Token, "personal access token to accept, generated unless a password is given")
+	fakeFlags.StringVar(&config.Version, "server-version", model.CurrentVersion, "server version to report")
+	fakeFlags.StringVar(&config.PluginDir, "dir", config.PluginDir, "directory to unpack uploaded plugins into, temporary by default")
+	if err := fakeFlags.Parse(args); err != nil {
+		return usageErrorf("%s", err.Error())
+	}
+	command := fakeFlags.Args()
+
+	if config.Token == "" && config.Password == "" {
+		config.Token = model.NewId()
+	}
+	if listen == "" {
+		listen = "127.0.0.1:8065"
+		if len(command) > 0 {
+			listen = "127.0.0.1:0"
+		}
+	}
+
+	server, err := fakeserver.New(config)
+	if err != nil {
+		return errors.Wrap(err, "failed to start fake server")
+	}
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s", listen)
+	}
+	httpServer := &http.Server{Handler: server}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+
+	siteURL := "http://" + listener.Addr().String()
+	env := []string{"MM_SERVICESETTINGS_SITEURL=" + siteURL}
+	if config.Token != "" {
+		env = append(env, "MM_ADMIN_TOKEN="+config.Token)
+	}
+	if config.Password != "" {
+		env = append(env, "MM_ADMIN_USERNAME="+config.Username, "MM_ADMIN_PASSWORD="+config.Password)
+	}
+
+	var commandErr error
+	if len(command) > 0 {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdin = os.Stdin
+		// Keep standard out to the JSON document in JSON mode.
+		cmd.Stdout = r.stdout
+		if r.json {
+			cmd.Stdout = r.stderr
+		}
+		cmd.Stderr = r.stderr
+		commandErr = cmd.Run()
+	} else {
+		fmt.Fprintf(r.stderr, "fake server listening on %s, interrupt to stop\n", siteURL)
+		for _, variable := range env {
+			fmt.Fprintf(r.stderr, "    export %s\n", variable)
+		}
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		signal.Stop(interrupt)
+	}
+
+	plugins := []fakePlugin{}
+	for _, plugin := range server.Plugins() {
+		plugins = append(plugins, fakePlugin{plugin.Manifest.Id, plugin.Manifest.Version, plugin.Enabled})
+	}
+	r.Result(map[string][]fakePlugin{"plugins": plugins}, func(w io.Writer) {
+		writeFakePluginsTable(w, plugins)
+	})
+
+	if commandErr != nil {
+		return withExitCode(exitCheckFailed, errors.Wrapf(commandErr, "%s failed against the fake server", command[0]))
+	}
+
+	return nil
+}
+
+// writeFakePluginsTable describes each installed plugin as a row of a table.
+func writeFakePluginsTable(w io.Writer, plugins []fakePlugin) {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "PLUGIN\tVERSION\tENABLED")
+	for _, plugin := range plugins {
+		fmt.Fprintf(table, "%s\t%s\t%t\n", plugin.Id, plugin.Version, plugin.Enabled)
+	}
+	table.Flush()
+}
@@ -0,0 +1,450 @@
+// Package fakeserver implements the subset of the Mattermost REST API used by model.Client4 to
+// deploy a plugin: logging in, uploading, removing, enabling and disabling plugins, and listing
+// their statuses. Plugins are kept in memory, and uploaded bundles unpacked and validated as the
+// server itself would, so that deployments can be exercised offline.
+//
+// A Server is an http.Handler, typically served by httptest.NewServer in tests:
+//
+//	server, err := fakeserver.New(fakeserver.Config{Token: "token"})
+//	...
+//	defer server.Close()
+//	ts := httptest.NewServer(server)
+//	defer ts.Close()
+package fakeserver
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// apiPrefix is the path under which model.Client4 expects the API.
+const apiPrefix = "/api/v4"
+
+// maxUploadSize matches the server's default limit on plugin bundles.
+const maxUploadSize = 50 * 1024 * 1024
+
+// validPluginId matches the plugin ids accepted by the server.
+var validPluginId = regexp.MustCompile(`^[a-zA-Z0-9-_\.]{3,190}$`)
+
+// Config describes the credentials the fake server accepts and the version it reports.
+type Config struct {
+	// Username and Password are accepted by users/login, if both are set.
+	Username string
+	Password string
+	// Token is a personal access token accepted in place of a session, if set.
+	Token string
+	// Version is the server version reported to clients, model.CurrentVersion by default.
+	Version string
+	// PluginDir is where uploaded bundles are unpacked. If empty, a temporary directory is
+	// created and removed by Close.
+	PluginDir string
+}
+
+// Plugin is an installed plugin.
+type Plugin struct {
+	Manifest *model.Manifest
+	// Path is the directory the bundle was unpacked to, containing the manifest.
+	Path    string
+	Enabled bool
+}
+
+// Server is a fake Mattermost server holding its plugins in memory.
+type Server struct {
+	config    Config
+	removeDir bool
+	user      *model.User
+
+	mutex    sync.Mutex
+	sessions map[string]bool
+	plugins  map[string]*Plugin
+}
+
+// New returns a server with no plugins installed.
+func New(config Config) (*Server, error) {
+	if config.Version == "" {
+		config.Version = model.CurrentVersion
+	}
+
+	s := &Server{
+		config:   config,
+		sessions: make(map[string]bool),
+		plugins:  make(map[string]*Plugin),
+		user: &model.User{
+			Id:       model.NewId(),
+			Username: config.Username,
+			Roles:    model.SYSTEM_ADMIN_ROLE_ID + " " + model.SYSTEM_USER_ROLE_ID,
+		},
+	}
+
+	if s.config.PluginDir == "" {
+		dir, err := ioutil.TempDir("", "fakeserver")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create plugin directory")
+		}
+		s.config.PluginDir = dir
+		s.removeDir = true
+	} else if err := os.MkdirAll(s.config.PluginDir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", s.config.PluginDir)
+	}
+
+	return s, nil
+}
+
+// Close removes the plugin directory, if it was created by New.
+func (s *Server) Close() error {
+	if !s.removeDir {
+		return nil
+	}
+
+	return os.RemoveAll(s.config.PluginDir)
+}
+
+// Plugins returns a copy of every installed plugin, sorted by id.
+func (s *Server) Plugins() []Plugin {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	plugins := make([]Plugin, 0, len(s.plugins))
+	for _, plugin := range s.plugins {
+		plugins = append(plugins, *plugin)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Manifest.Id < plugins[j].Manifest.Id })
+
+	return plugins
+}
+
+// ServeHTTP routes the supported API endpoints, failing any others as not found.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(model.HEADER_VERSION_ID, s.config.Version+"."+s.config.Version+".0.false")
+	w.Header().Set(model.HEADER_REQUEST_ID, model.NewId())
+
+	if !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		writeError(w, "ServeHTTP", "api.context.404.app_error", "", http.StatusNotFound)
+		return
+	}
+	route := strings.Split(strings.TrimPrefix(r.URL.Path, apiPrefix+"/"), "/")
+
+	// These are the only endpoints available without a session.
+	switch {
+	case r.Method == http.MethodGet && matchRoute(route, "system", "ping"):
+		writeStatusOK(w)
+		return
+
+	case r.Method == http.MethodGet && matchRoute(route, "config", "client"):
+		writeJSON(w, http.StatusOK, map[string]string{"Version": s.config.Version})
+		return
+
+	case r.Method == http.MethodPost && matchRoute(route, "users", "login"):
+		s.login(w, r)
+		return
+	}
+
+	if !s.authenticated(r) {
+		writeError(w, "ServeHTTP", "api.context.session_expired.app_error", "", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && matchRoute(route, "users", "logout"):
+		s.logout(w, r)
+
+	case r.Method == http.MethodGet && matchRoute(route, "users", "me"):
+		writeJSON(w, http.StatusOK, s.user)
+
+	case r.Method == http.MethodPost && matchRoute(route, "plugins"):
+		s.uploadPlugin(w, r)
+
+	case r.Method == http.MethodGet && matchRoute(route, "plugins"):
+		s.getPlugins(w)
+
+	case r.Method == http.MethodGet && matchRoute(route, "plugins", "statuses"):
+		s.getPluginStatuses(w)
+
+	case r.Method == http.MethodDelete && matchRoute(route, "plugins", ""):
+		s.removePlugin(w, route[1])
+
+	case r.Method == http.MethodPost && matchRoute(route, "plugins", "", "enable"):
+		s.setPluginEnabled(w, route[1], true)
+
+	case r.Method == http.MethodPost && matchRoute(route, "plugins", "", "disable"):
+		s.setPluginEnabled(w, route[1], false)
+
+	default:
+		writeError(w, "ServeHTTP", "api.context.404.app_error", r.Method+" "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+// matchRoute reports whether route consists of the given segments, where an empty segment
+// matches any single non-empty one.
+func matchRoute(route []string, segments ...string) bool {
+	if len(route) != len(segments) {
+		return false
+	}
+	for i, segment := range segments {
+		if route[i] == "" || (segment != "" && route[i] != segment) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// authenticated reports whether the request carries a current session or the access token.
+func (s *Server) authenticated(r *http.Request) bool {
+	token := sessionToken(r)
+	if token == "" {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sessions[token] || (s.config.Token != "" && token == s.config.Token)
+}
+
+func sessionToken(r *http.Request) string {
+	auth := r.Header.Get(model.HEADER_AUTH)
+	for _, prefix := range []string{model.HEADER_BEARER, model.HEADER_TOKEN} {
+		if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+			return strings.TrimSpace(auth[len(prefix):])
+		}
+	}
+
+	return ""
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	props := model.MapFromJson(r.Body)
+	if s.config.Username == "" || s.config.Password == "" ||
+		props["login_id"] != s.config.Username || props["password"] != s.config.Password {
+		writeError(w, "login", "api.user.login.invalid_credentials", "", http.StatusUnauthorized)
+		return
+	}
+
+	token := model.NewId()
+	s.mutex.Lock()
+	s.sessions[token] = true
+	s.mutex.Unlock()
+
+	w.Header().Set(model.HEADER_TOKEN, token)
+	writeJSON(w, http.StatusOK, s.user)
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	delete(s.sessions, sessionToken(r))
+	s.mutex.Unlock()
+
+	writeStatusOK(w)
+}
+
+// uploadPlugin unpacks the bundle in the plugin form field and installs it, failing if a
+// plugin with the same id is already installed.
+func (s *Server) uploadPlugin(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, _, err := r.FormFile("plugin")
+	if err != nil {
+		writeError(w, "uploadPlugin", "api.plugin.upload.file.app_error", err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	tmpDir, err := ioutil.TempDir(s.config.PluginDir, ".upload")
+	if err != nil {
+		writeError(w, "uploadPlugin", "app.plugin.filesystem.app_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := extractBundle(file, tmpDir); err != nil {
+		writeError(w, "installPlugin", "app.plugin.extract.app_error", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Bundles conventionally contain a single directory named after the plugin.
+	pluginDir := tmpDir
+	entries, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		writeError(w, "installPlugin", "app.plugin.filesystem.app_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		pluginDir = filepath.Join(tmpDir, entries[0].Name())
+	}
+
+	manifest, _, err := model.FindManifest(pluginDir)
+	if err != nil {
+		writeError(w, "installPlugin", "app.plugin.manifest.app_error", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validPluginId.MatchString(manifest.Id) {
+		writeError(w, "installPlugin", "app.plugin.invalid_id.app_error", manifest.Id, http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.plugins[manifest.Id] != nil {
+		writeError(w, "installPlugin", "app.plugin.install_id.app_error", manifest.Id, http.StatusBadRequest)
+		return
+	}
+
+	installDir := filepath.Join(s.config.PluginDir, manifest.Id)
+	if err := os.RemoveAll(installDir); err != nil {
+		writeError(w, "installPlugin", "app.plugin.filesystem.app_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(pluginDir, installDir); err != nil {
+		writeError(w, "installPlugin", "app.plugin.filesystem.app_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.plugins[manifest.Id] = &Plugin{Manifest: manifest, Path: installDir}
+	writeJSON(w, http.StatusCreated, manifest)
+}
+
+func (s *Server) getPlugins(w http.ResponseWriter) {
+	response := &model.PluginsResponse{Active: []*model.PluginInfo{}, Inactive: []*model.PluginInfo{}}
+	for _, plugin := range s.Plugins() {
+		info := &model.PluginInfo{Manifest: *plugin.Manifest}
+		if plugin.Enabled {
+			response.Active = append(response.Active, info)
+		} else {
+			response.Inactive = append(response.Inactive, info)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getPluginStatuses reports every enabled plugin as running. Note that model.Client4 at this
+// version requests the plugin list instead, so it is only reachable by other clients.
+func (s *Server) getPluginStatuses(w http.ResponseWriter) {
+	statuses := model.PluginStatuses{}
+	for _, plugin := range s.Plugins() {
+		state := model.PluginStateNotRunning
+		if plugin.Enabled {
+			state = model.PluginStateRunning
+		}
+		statuses = append(statuses, &model.PluginStatus{
+			PluginId:    plugin.Manifest.Id,
+			PluginPath:  plugin.Path,
+			State:       state,
+			Name:        plugin.Manifest.Name,
+			Description: plugin.Manifest.Description,
+			Version:     plugin.Manifest.Version,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) removePlugin(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	plugin := s.plugins[id]
+	if plugin == nil {
+		writeError(w, "removePlugin", "app.plugin.not_installed.app_error", id, http.StatusBadRequest)
+		return
+	}
+	if err := os.RemoveAll(plugin.Path); err != nil {
+		writeError(w, "removePlugin", "app.plugin.remove.app_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	delete(s.plugins, id)
+
+	writeStatusOK(w)
+}
+
+func (s *Server) setPluginEnabled(w http.ResponseWriter, id string, enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	plugin := s.plugins[id]
+	if plugin == nil {
+		writeError(w, "setPluginEnabled", "app.plugin.not_installed.app_error", id, http.StatusBadRequest)
+		return
+	}
+	plugin.Enabled = enabled
+
+	writeStatusOK(w)
+}
+
+// extractBundle unpacks the tar.gz bundle into dir, rejecting entries that would escape it.
+func extractBundle(r io.Reader, dir string) error {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read bundle")
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read bundle")
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return errors.Errorf("%s is outside the bundle", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode)&0755|0600)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, tarReader); err != nil {
+				file.Close()
+				return errors.Wrapf(err, "failed to extract %s", header.Name)
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+
+		default:
+			return errors.Errorf("%s is not a regular file or directory", header.Name)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeStatusOK(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]string{model.STATUS: model.STATUS_OK})
+}
+
+func writeError(w http.ResponseWriter, where, id, details string, status int) {
+	writeJSON(w, status, model.NewAppError(where, id, nil, details, status))
+}
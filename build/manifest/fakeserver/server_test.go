@@ -0,0 +1,203 @@
+package fakeserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testBundle returns a tar.gz bundle containing the given entries.
+func testBundle(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// serve sends a request authenticated with token to the server and returns the response.
+func serve(s *Server, method, path, token string, body []byte, contentType string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// upload posts the bundle as the plugin form field, as model.Client4.UploadPlugin does.
+func upload(t *testing.T, s *Server, token string, bundle []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("plugin", "plugin.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(bundle); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return serve(s, http.MethodPost, "/api/v4/plugins", token, body.Bytes(), writer.FormDataContentType())
+}
+
+func TestServeHTTPRequiresSession(t *testing.T) {
+	s, err := New(Config{Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, test := range []struct {
+		method, path, token string
+		status              int
+	}{
+		{http.MethodGet, "/api/v4/system/ping", "", http.StatusOK},
+		{http.MethodGet, "/api/v4/config/client", "", http.StatusOK},
+		{http.MethodGet, "/api/v4/plugins", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v4/plugins", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v4/plugins", "token", http.StatusOK},
+		{http.MethodGet, "/api/v4/users/me", "token", http.StatusOK},
+		{http.MethodGet, "/api/v4/unknown", "token", http.StatusNotFound},
+		{http.MethodDelete, "/api/v4/plugins/", "token", http.StatusNotFound},
+		{http.MethodGet, "/unknown", "", http.StatusNotFound},
+	} {
+		if recorder := serve(s, test.method, test.path, test.token, nil, ""); recorder.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d", test.method, test.path, test.status, recorder.Code)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s, err := New(Config{Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if recorder := serve(s, http.MethodPost, "/api/v4/users/login", "", []byte(`{"login_id": "admin", "password": "wrong"}`), ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected an invalid password to be rejected, got status %d", recorder.Code)
+	}
+
+	recorder := serve(s, http.MethodPost, "/api/v4/users/login", "", []byte(`{"login_id": "admin", "password": "secret"}`), "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected to log in, got status %d", recorder.Code)
+	}
+	token := recorder.Header().Get("Token")
+	if token == "" {
+		t.Fatal("expected a session token")
+	}
+	if recorder := serve(s, http.MethodGet, "/api/v4/plugins", token, nil, ""); recorder.Code != http.StatusOK {
+		t.Errorf("expected the session to be accepted, got status %d", recorder.Code)
+	}
+
+	serve(s, http.MethodPost, "/api/v4/users/logout", token, nil, "")
+	if recorder := serve(s, http.MethodGet, "/api/v4/plugins", token, nil, ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected the session to end on logout, got status %d", recorder.Code)
+	}
+}
+
+func TestUploadPlugin(t *testing.T) {
+	s, err := New(Config{Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	bundle := testBundle(t, map[string]string{
+		"com.example.test/plugin.json": `{"id": "com.example.test", "version": "0.1.0"}`,
+	})
+	if recorder := upload(t, s, "token", bundle); recorder.Code != http.StatusCreated {
+		t.Fatalf("expected the plugin to be installed, got status %d: %s", recorder.Code, recorder.Body)
+	}
+	plugins := s.Plugins()
+	if len(plugins) != 1 || plugins[0].Manifest.Version != "0.1.0" || plugins[0].Enabled {
+		t.Fatalf("expected version 0.1.0 installed and disabled, got %+v", plugins)
+	}
+	if _, err := os.Stat(filepath.Join(plugins[0].Path, "plugin.json")); err != nil {
+		t.Errorf("expected the bundle to be unpacked: %v", err)
+	}
+
+	recorder := upload(t, s, "token", bundle)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "app.plugin.install_id.app_error") {
+		t.Errorf("expected an installed plugin to be rejected, got status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	if recorder := serve(s, http.MethodPost, "/api/v4/plugins/com.example.test/enable", "token", nil, ""); recorder.Code != http.StatusOK {
+		t.Errorf("expected the plugin to be enabled, got status %d", recorder.Code)
+	}
+	if plugins := s.Plugins(); !plugins[0].Enabled {
+		t.Error("expected the plugin to be enabled")
+	}
+
+	if recorder := serve(s, http.MethodDelete, "/api/v4/plugins/com.example.test", "token", nil, ""); recorder.Code != http.StatusOK {
+		t.Errorf("expected the plugin to be removed, got status %d", recorder.Code)
+	}
+	if plugins := s.Plugins(); len(plugins) != 0 {
+		t.Errorf("expected no plugins installed, got %+v", plugins)
+	}
+	if recorder := serve(s, http.MethodDelete, "/api/v4/plugins/com.example.test", "token", nil, ""); recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected removing a missing plugin to fail, got status %d", recorder.Code)
+	}
+}
+
+func TestUploadPluginInvalidBundle(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{"no manifest", map[string]string{"com.example.test/README.md": "readme"}, "app.plugin.manifest.app_error"},
+		{"invalid id", map[string]string{"plugin.json": `{"id": "a"}`}, "app.plugin.invalid_id.app_error"},
+		{"escaping entry", map[string]string{"../../escaped.json": `{"id": "com.example.test"}`}, "is outside the bundle"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := New(Config{Token: "token"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			recorder := upload(t, s, "token", testBundle(t, test.files))
+			if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), test.err) {
+				t.Errorf("expected status 400 with %q, got status %d: %s", test.err, recorder.Code, recorder.Body)
+			}
+			if plugins := s.Plugins(); len(plugins) != 0 {
+				t.Errorf("expected no plugins installed, got %+v", plugins)
+			}
+		})
+	}
+}
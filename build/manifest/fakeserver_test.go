@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stevepartridge/mattermost-plugin-webex/build/manifest/fakeserver"
+)
+
+func TestDeployPluginToFakeServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakeserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server, err := fakeserver.New(fakeserver.Config{Username: "admin", Password: "secret", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for _, test := range []struct {
+		name    string
+		config  deployConfig
+		version string
+		err     string
+	}{
+		{"install with a token", deployConfig{Token: "token"}, "0.1.0", ""},
+		{"replace with a password", deployConfig{Username: "admin", Password: "secret"}, "0.2.0", ""},
+		{"invalid token", deployConfig{Token: "wrong"}, "0.3.0", "failed to authenticate with access token"},
+		{"invalid password", deployConfig{Username: "admin", Password: "wrong"}, "0.3.0", "failed to log in as admin"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			bundlePath := filepath.Join(dir, test.version+".tar.gz")
+			writeTestBundle(t, bundlePath, map[string]string{
+				"plugin.json": `{"id": "com.example.test", "version": "` + test.version + `"}`,
+			})
+
+			test.config.SiteURL = ts.URL
+			err := deployPlugin(test.config, "com.example.test", bundlePath)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plugins := server.Plugins()
+			if len(plugins) != 1 {
+				t.Fatalf("expected one plugin installed, got %d", len(plugins))
+			}
+			if plugins[0].Manifest.Version != test.version || !plugins[0].Enabled {
+				t.Errorf("expected version %s enabled, got version %s enabled %t", test.version, plugins[0].Manifest.Version, plugins[0].Enabled)
+			}
+		})
+	}
+
+	// The failed deployments left the last successful one in place.
+	if plugins := server.Plugins(); len(plugins) != 1 || plugins[0].Manifest.Version != "0.2.0" {
+		t.Errorf("expected version 0.2.0 to remain installed, got %+v", plugins)
+	}
+}
+
+func TestDeployPluginMismatchedId(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakeserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server, err := fakeserver.New(fakeserver.Config{Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	bundlePath := filepath.Join(dir, "plugin.tar.gz")
+	writeTestBundle(t, bundlePath, map[string]string{"plugin.json": `{"id": "com.example.other", "version": "0.1.0"}`})
+
+	err = deployPlugin(deployConfig{SiteURL: ts.URL, Token: "token"}, "com.example.test", bundlePath)
+	if err == nil || !strings.Contains(err.Error(), "uploaded bundle contains plugin com.example.other, expected com.example.test") {
+		t.Errorf("expected a mismatched id error, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+)
+
+// describeVersion derives the plugin version from the most recent tag reachable from HEAD in
+// the git checkout at root, such as v1.2.3. On the tagged commit itself, the version is that of
+// the tag. Otherwise it is a development prerelease of the next patch release, numbered by the
+// commits since the tag, with the abbreviated commit as build metadata: 1.2.4-dev.5+g1a2b3c4.
+// A prerelease tag such as v1.3.0-rc.1 is extended instead: 1.3.0-rc.1.dev.5+g1a2b3c4.
+//
+// Without any tags, manifestVersion is taken to be the upcoming release, so that a checkout
+// with 7 commits and version 0.1.0 in the manifest yields 0.1.0-dev.7+g1a2b3c4.
+func describeVersion(root, manifestVersion string) (string, error) {
+	if _, err := runGit(root, "rev-parse", "HEAD"); err != nil {
+		return "", errors.Wrapf(err, "%s is not a git checkout", root)
+	}
+
+	description, err := runGit(root, "describe", "--tags", "--long", "--abbrev=7", "--match", "v[0-9]*", "--match", "[0-9]*")
+	if err == nil {
+		return versionFromDescription(description)
+	}
+
+	version, err := semver.Parse(manifestVersion)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse version %s", manifestVersion)
+	}
+	count, err := runGit(root, "rev-list", "--count", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	commits, err := strconv.ParseUint(count, 10, 64)
+	if err != nil {
+		return "", errors.Wrapf(err, "unexpected output from git rev-list: %s", count)
+	}
+	commit, err := runGit(root, "rev-parse", "--short=7", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return developmentVersion(version, commits, "g"+commit), nil
+}
+
+// versionFromDescription derives the version from the output of git describe --long, such as
+// v1.2.3-5-g1a2b3c4, as documented by describeVersion.
+func versionFromDescription(description string) (string, error) {
+	// The tag itself may contain dashes, so the count and commit are taken from the end.
+	parts := strings.Split(description, "-")
+	if len(parts) < 3 {
+		return "", errors.Errorf("unexpected output from git describe: %s", description)
+	}
+	tag := strings.Join(parts[:len(parts)-2], "-")
+	version, err := semver.ParseTolerant(tag)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse tag %s as a version", tag)
+	}
+	commits, err := strconv.ParseUint(parts[len(parts)-2], 10, 64)
+	if err != nil {
+		return "", errors.Wrapf(err, "unexpected output from git describe: %s", description)
+	}
+	if commits == 0 {
+		return version.String(), nil
+	}
+	if len(version.Pre) == 0 {
+		version.Patch++
+	}
+
+	return developmentVersion(version, commits, parts[len(parts)-1]), nil
+}
+
+// developmentVersion marks version as a development prerelease the given number of commits
+// after it, built from commit.
+func developmentVersion(version semver.Version, commits uint64, commit string) string {
+	version.Pre = append(version.Pre, semver.PRVersion{VersionStr: "dev"}, semver.PRVersion{VersionNum: commits, IsNum: true})
+	version.Build = []string{commit}
+
+	return version.String()
+}
+
+// versionedManifest returns the manifest at manifestPath with its version replaced, leaving
+// the rest of the file as written.
+func versionedManifest(manifestPath, version string) ([]byte, error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", manifestPath)
+	}
+
+	manifest, err := decodeManifest(bytes.NewReader(data), manifestFormat(manifestPath), true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", manifestPath)
+	}
+	if manifest.Version == version {
+		return data, nil
+	}
+
+	data, err = replaceManifestVersion(data, manifestFormat(manifestPath), manifest.Version, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to update %s", manifestPath)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersionFromDescription(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		expected    string
+		err         string
+	}{
+		{"v1.2.3-0-g1a2b3c4", "1.2.3", ""},
+		{"1.2.3-0-g1a2b3c4", "1.2.3", ""},
+		{"v1.2.3-5-g1a2b3c4", "1.2.4-dev.5+g1a2b3c4", ""},
+		{"v1.3.0-rc.1-0-g1a2b3c4", "1.3.0-rc.1", ""},
+		{"v1.3.0-rc.1-5-g1a2b3c4", "1.3.0-rc.1.dev.5+g1a2b3c4", ""},
+		{"v1.3.0-rc-1-2-g1a2b3c4", "1.3.0-rc-1.dev.2+g1a2b3c4", ""},
+		{"v1.2-5-g1a2b3c4", "1.2.1-dev.5+g1a2b3c4", ""},
+		{"g1a2b3c4", "", "unexpected output from git describe: g1a2b3c4"},
+		{"vnext-5-g1a2b3c4", "", "failed to parse tag vnext as a version"},
+		{"v1.2.3-many-g1a2b3c4", "", "unexpected output from git describe: v1.2.3-many-g1a2b3c4"},
+	} {
+		t.Run(test.description, func(t *testing.T) {
+			version, err := versionFromDescription(test.description)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, version)
+			}
+		})
+	}
+}
+
+func TestDescribeVersion(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "gitversion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		output, err := runGit(dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+	commit := func() {
+		git("commit", "--allow-empty", "--quiet", "--message", "commit")
+	}
+	describe := func() string {
+		version, err := describeVersion(dir, "0.1.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return version
+	}
+
+	if _, err := describeVersion(filepath.Join(dir, "missing"), "0.1.0"); err == nil {
+		t.Error("expected an error outside a git checkout")
+	}
+
+	git("init", "--quiet")
+	commit()
+	commit()
+	head := git("rev-parse", "--short=7", "HEAD")
+	if version, expected := describe(), "0.1.0-dev.2+g"+head; version != expected {
+		t.Errorf("without tags, expected %s, got %s", expected, version)
+	}
+
+	git("tag", "v0.1.0")
+	if version, expected := describe(), "0.1.0"; version != expected {
+		t.Errorf("on a tag, expected %s, got %s", expected, version)
+	}
+
+	commit()
+	head = git("rev-parse", "--short=7", "HEAD")
+	if version, expected := describe(), "0.1.1-dev.1+g"+head; version != expected {
+		t.Errorf("after a tag, expected %s, got %s", expected, version)
+	}
+}
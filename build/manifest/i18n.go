@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// defaultI18nDir is where the message catalogs live, relative to the plugin root.
+const defaultI18nDir = "assets/i18n"
+
+// sourceLocale is the locale of the strings in the manifest, and of the extracted catalog.
+const sourceLocale = "en"
+
+// i18nMessage is a single entry of a catalog, in the format read by go-i18n and used by the
+// server's own translations.
+type i18nMessage struct {
+	Id          string `json:"id"`
+	Translation string `json:"translation"`
+	// Source is, in a translated catalog, the source text the translation was made from. The
+	// server ignores it.
+	Source string `json:"source,omitempty"`
+}
+
+// localeReport lists the problems with a single translated catalog. Missing messages are in
+// the source catalog, but untranslated; stale messages are no longer in the source catalog;
+// outdated messages were translated from a source text that has since changed.
+type localeReport struct {
+	Locale   string   `json:"locale"`
+	Path     string   `json:"path"`
+	Missing  []string `json:"missing"`
+	Stale    []string `json:"stale"`
+	Outdated []string `json:"outdated"`
+}
+
+// i18nResult describes the source catalog and the state of each translation.
+type i18nResult struct {
+	Catalog  string          `json:"catalog"`
+	Messages int             `json:"messages"`
+	Locales  []*localeReport `json:"locales"`
+}
+
+// extractMessages returns the translatable strings of the settings schema, keyed by stable
+// message ids derived from the plugin id, setting key and field, sorted by id.
+func extractMessages(manifest *model.Manifest) []i18nMessage {
+	var messages []i18nMessage
+	add := func(id, text string) {
+		if text != "" {
+			messages = append(messages, i18nMessage{Id: id, Translation: text})
+		}
+	}
+
+	if manifest.SettingsSchema != nil {
+		for _, setting := range manifest.SettingsSchema.Settings {
+			if setting == nil || setting.Key == "" {
+				continue
+			}
+
+			prefix := manifest.Id + ".setting." + setting.Key
+			add(prefix+".display_name", setting.DisplayName)
+			add(prefix+".help_text", setting.HelpText)
+			add(prefix+".placeholder", setting.Placeholder)
+			add(prefix+".regenerate_help_text", setting.RegenerateHelpText)
+			for _, option := range setting.Options {
+				if option != nil {
+					add(prefix+".option."+option.Value+".display_name", option.DisplayName)
+				}
+			}
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Id < messages[j].Id })
+
+	return messages
+}
+
+// renderCatalog encodes the messages as a catalog file.
+func renderCatalog(messages []i18nMessage) ([]byte, error) {
+	if messages == nil {
+		messages = []i18nMessage{}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(messages); err != nil {
+		return nil, errors.Wrap(err, "failed to encode catalog")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// extractCatalog writes the source catalog for the manifest into dir, records the current source
+// text against any translation without one, and reports on every other catalog in dir.
+func extractCatalog(manifest *model.Manifest, dir string) (*i18nResult, error) {
+	messages := extractMessages(manifest)
+	data, err := renderCatalog(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", dir)
+	}
+	catalogPath := filepath.Join(dir, sourceLocale+".json")
+	if err := ioutil.WriteFile(catalogPath, data, 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %s", catalogPath)
+	}
+
+	if err := stampLocales(messages, dir); err != nil {
+		return nil, err
+	}
+
+	return checkLocales(messages, dir, catalogPath)
+}
+
+// stampLocales sets the source of every translation in the other catalogs in dir that lacks
+// one to the current source text, so that later changes to the source text are detected.
+// Translators update the source along with the translation.
+func stampLocales(messages []i18nMessage, dir string) error {
+	sources := make(map[string]string)
+	for _, message := range messages {
+		sources[message.Id] = message.Translation
+	}
+
+	paths, err := localeCatalogs(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, localePath := range paths {
+		translations, err := readCatalog(localePath)
+		if err != nil {
+			return err
+		}
+
+		var stamped bool
+		for i, translation := range translations {
+			if source, ok := sources[translation.Id]; ok && translation.Translation != "" && translation.Source == "" {
+				translations[i].Source = source
+				stamped = true
+			}
+		}
+		if !stamped {
+			continue
+		}
+
+		data, err := renderCatalog(translations)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(localePath, data, 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %s", localePath)
+		}
+	}
+
+	return nil
+}
+
+// checkCatalog returns a unified diff if the source catalog in dir is out of date with the
+// manifest, along with a report on every other catalog in dir.
+func checkCatalog(manifest *model.Manifest, dir string) (*i18nResult, string, error) {
+	messages := extractMessages(manifest)
+	data, err := renderCatalog(messages)
+	if err != nil {
+		return nil, "", err
+	}
+
+	catalogPath := filepath.Join(dir, sourceLocale+".json")
+	existing, err := ioutil.ReadFile(catalogPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", errors.Wrapf(err, "failed to read %s", catalogPath)
+	}
+
+	result, err := checkLocales(messages, dir, catalogPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return result, unifiedDiff(catalogPath, catalogPath, existing, data), nil
+}
+
+// checkLocales compares every catalog in dir other than the source catalog against messages.
+func checkLocales(messages []i18nMessage, dir, catalogPath string) (*i18nResult, error) {
+	result := &i18nResult{Catalog: catalogPath, Messages: len(messages), Locales: []*localeReport{}}
+
+	paths, err := localeCatalogs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, localePath := range paths {
+		translations, err := readCatalog(localePath)
+		if err != nil {
+			return nil, err
+		}
+
+		translated := make(map[string]bool)
+		for _, translation := range translations {
+			if translation.Translation != "" {
+				translated[translation.Id] = true
+			}
+		}
+
+		report := &localeReport{
+			Locale:   strings.TrimSuffix(filepath.Base(localePath), ".json"),
+			Path:     localePath,
+			Missing:  []string{},
+			Stale:    []string{},
+			Outdated: []string{},
+		}
+		sources := make(map[string]string)
+		for _, message := range messages {
+			sources[message.Id] = message.Translation
+			if !translated[message.Id] {
+				report.Missing = append(report.Missing, message.Id)
+			}
+		}
+		for _, translation := range translations {
+			source, ok := sources[translation.Id]
+			if !ok {
+				report.Stale = append(report.Stale, translation.Id)
+			} else if translated[translation.Id] && translation.Source != "" && translation.Source != source {
+				report.Outdated = append(report.Outdated, translation.Id)
+			}
+		}
+
+		result.Locales = append(result.Locales, report)
+	}
+
+	return result, nil
+}
+
+// localeCatalogs returns the paths of the catalogs in dir other than the source catalog, sorted.
+func localeCatalogs(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %s", dir)
+	}
+
+	var locales []string
+	for _, localePath := range paths {
+		if filepath.Base(localePath) != sourceLocale+".json" {
+			locales = append(locales, localePath)
+		}
+	}
+	sort.Strings(locales)
+
+	return locales, nil
+}
+
+func readCatalog(catalogPath string) ([]i18nMessage, error) {
+	data, err := ioutil.ReadFile(catalogPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", catalogPath)
+	}
+
+	var messages []i18nMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", catalogPath)
+	}
+
+	return messages, nil
+}
+
+// problems returns the number of missing, stale and outdated translations across all locales.
+func (r *i18nResult) problems() int {
+	var count int
+	for _, locale := range r.Locales {
+		count += len(locale.Missing) + len(locale.Stale) + len(locale.Outdated)
+	}
+
+	return count
+}
+
+// writeLocaleReports describes the problems with each translated catalog.
+func writeLocaleReports(w io.Writer, result *i18nResult) {
+	for _, locale := range result.Locales {
+		if len(locale.Missing) == 0 && len(locale.Stale) == 0 && len(locale.Outdated) == 0 {
+			fmt.Fprintf(w, "%s: up to date\n", locale.Locale)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %d missing, %d stale, %d outdated\n", locale.Locale, len(locale.Missing), len(locale.Stale), len(locale.Outdated))
+		for _, id := range locale.Missing {
+			fmt.Fprintf(w, "    missing %s\n", id)
+		}
+		for _, id := range locale.Stale {
+			fmt.Fprintf(w, "    stale %s\n", id)
+		}
+		for _, id := range locale.Outdated {
+			fmt.Fprintf(w, "    outdated %s\n", id)
+		}
+	}
+}
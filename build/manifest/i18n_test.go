@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+func TestExtractCatalogOutdatedTranslations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := func(displayName, helpText string) *model.Manifest {
+		return &model.Manifest{
+			Id: "com.example.test",
+			SettingsSchema: &model.PluginSettingsSchema{
+				Settings: []*model.PluginSetting{{Key: "host", DisplayName: displayName, HelpText: helpText}},
+			},
+		}
+	}
+
+	frPath := filepath.Join(dir, "fr.json")
+	fr := `[
+    {"id": "com.example.test.setting.host.display_name", "translation": "Hôte"},
+    {"id": "com.example.test.setting.removed.display_name", "translation": "Supprimé"}
+]`
+	if err := ioutil.WriteFile(frPath, []byte(fr), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first extract records the source text each translation was made from.
+	if _, err := extractCatalog(manifest("Host", "The server host."), dir); err != nil {
+		t.Fatal(err)
+	}
+	translations, err := readCatalog(frPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []i18nMessage{
+		{Id: "com.example.test.setting.host.display_name", Translation: "Hôte", Source: "Host"},
+		{Id: "com.example.test.setting.removed.display_name", Translation: "Supprimé"},
+	}
+	if !reflect.DeepEqual(translations, expected) {
+		t.Errorf("expected %+v, got %+v", expected, translations)
+	}
+
+	result, err := extractCatalog(manifest("Server host", "The server host."), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Locales) != 1 {
+		t.Fatalf("expected one locale, got %d", len(result.Locales))
+	}
+	report := result.Locales[0]
+	if expected := []string{"com.example.test.setting.host.display_name"}; !reflect.DeepEqual(report.Outdated, expected) {
+		t.Errorf("expected outdated %q, got %q", expected, report.Outdated)
+	}
+	if expected := []string{"com.example.test.setting.host.help_text"}; !reflect.DeepEqual(report.Missing, expected) {
+		t.Errorf("expected missing %q, got %q", expected, report.Missing)
+	}
+	if expected := []string{"com.example.test.setting.removed.display_name"}; !reflect.DeepEqual(report.Stale, expected) {
+		t.Errorf("expected stale %q, got %q", expected, report.Stale)
+	}
+	if problems := result.problems(); problems != 3 {
+		t.Errorf("expected 3 problems, got %d", problems)
+	}
+}
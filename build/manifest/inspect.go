@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// inspectResult describes the contents of a plugin bundle.
+type inspectResult struct {
+	Bundle      string         `json:"bundle"`
+	Manifest    string         `json:"manifest"`
+	Id          string         `json:"id"`
+	Version     string         `json:"version"`
+	Executables []*inspectFile `json:"executables,omitempty"`
+	Webapp      *inspectFile   `json:"webapp,omitempty"`
+	Missing     []string       `json:"missing,omitempty"`
+}
+
+// inspectFile describes a file named by the manifest and whether the bundle contains it.
+type inspectFile struct {
+	Platform string `json:"platform,omitempty"`
+	Path     string `json:"path"`
+	Found    bool   `json:"found"`
+	Size     int64  `json:"size"`
+	Mode     string `json:"mode,omitempty"`
+	// BundleHash is the hex encoded 64-bit FNV-1a hash of the webapp bundle, as computed by the
+	// server into ManifestWebapp.BundleHash when the plugin is loaded.
+	BundleHash string `json:"bundle_hash,omitempty"`
+}
+
+// inspectBundle audits an existing plugin bundle, locating every executable and the webapp
+// bundle named by the manifest inside it.
+func inspectBundle(bundlePath string) (*inspectResult, error) {
+	bundleManifest, err := readBundleManifest(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := bundleManifest.Manifest
+
+	executables, err := manifestExecutableFiles(bundleManifest.Data, manifestFormat(bundleManifest.Name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read executables from %s", bundleManifest.Name)
+	}
+
+	result := &inspectResult{
+		Bundle:      bundlePath,
+		Manifest:    bundleManifest.Name,
+		Id:          manifest.Id,
+		Version:     manifest.Version,
+		Executables: executables,
+	}
+	if manifest.Webapp != nil {
+		result.Webapp = &inspectFile{Path: manifest.Webapp.BundlePath}
+	}
+
+	// Paths in the manifest are relative to the directory containing it.
+	root := path.Dir(bundleManifest.Name)
+	files := make(map[string][]*inspectFile)
+	for _, file := range result.Executables {
+		files[path.Join(root, file.Path)] = append(files[path.Join(root, file.Path)], file)
+	}
+	if result.Webapp != nil {
+		files[path.Join(root, result.Webapp.Path)] = append(files[path.Join(root, result.Webapp.Path)], result.Webapp)
+	}
+
+	err = walkBundle(bundlePath, func(header *tar.Header, r io.Reader) error {
+		name := strings.TrimPrefix(path.Clean(header.Name), "./")
+		if header.Typeflag != tar.TypeReg || files[name] == nil {
+			return nil
+		}
+
+		for _, file := range files[name] {
+			file.Found = true
+			file.Size = header.Size
+			file.Mode = os.FileMode(header.Mode).String()
+		}
+
+		if result.Webapp != nil && name == path.Join(root, result.Webapp.Path) {
+			hash := fnv.New64a()
+			if _, err := io.Copy(hash, r); err != nil {
+				return err
+			}
+			result.Webapp.BundleHash = hex.EncodeToString(hash.Sum(nil))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range result.Executables {
+		if !file.Found {
+			result.Missing = append(result.Missing, file.Path)
+		}
+	}
+	if result.Webapp != nil && !result.Webapp.Found {
+		result.Missing = append(result.Missing, result.Webapp.Path)
+	}
+
+	return result, nil
+}
+
+// manifestExecutableFiles lists the executables declared by the manifest encoded in the given
+// format, one per platform sorted by name, followed by the fallback executable, if any.
+func manifestExecutableFiles(data []byte, format string) ([]*inspectFile, error) {
+	executables, fallback, err := manifestExecutables(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	platforms := make([]string, 0, len(executables))
+	for platform := range executables {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	var files []*inspectFile
+	for _, platform := range platforms {
+		files = append(files, &inspectFile{Platform: platform, Path: path.Clean(executables[platform])})
+	}
+	if fallback != "" {
+		files = append(files, &inspectFile{Platform: "default", Path: path.Clean(fallback)})
+	}
+
+	return files, nil
+}
+
+// writeInspectTable describes the inspected bundle as a table.
+func writeInspectTable(w io.Writer, result *inspectResult) {
+	fmt.Fprintf(w, "%s %s (%s in %s)\n\n", result.Id, result.Version, result.Manifest, result.Bundle)
+
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "KIND\tPLATFORM\tPATH\tSIZE\tMODE\tHASH")
+	for _, file := range result.Executables {
+		writeInspectRow(table, "executable", file)
+	}
+	if result.Webapp != nil {
+		writeInspectRow(table, "webapp", result.Webapp)
+	}
+	table.Flush()
+}
+
+func writeInspectRow(w io.Writer, kind string, file *inspectFile) {
+	if !file.Found {
+		fmt.Fprintf(w, "%s\t%s\t%s\tmissing\t\t\n", kind, file.Platform, file.Path)
+		return
+	}
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", kind, file.Platform, file.Path, file.Size, file.Mode, file.BundleHash)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const inspectManifest = `{
+    "id": "com.example.test",
+    "version": "0.1.0",
+    "server": {
+        "executables": {
+            "linux-amd64": "server/dist/plugin-linux-amd64",
+            "darwin-amd64": "server/dist/plugin-darwin-amd64"
+        }
+    },
+    "webapp": {
+        "bundle_path": "webapp/dist/main.js"
+    }
+}`
+
+func TestInspectBundle(t *testing.T) {
+	const webapp = "console.log('test');\n"
+	hash := fnv.New64a()
+	hash.Write([]byte(webapp))
+	webappHash := hex.EncodeToString(hash.Sum(nil))
+
+	for _, test := range []struct {
+		name       string
+		files      map[string]string
+		missing    []string
+		bundleHash string
+		mismatch   bool
+	}{
+		{
+			name: "complete",
+			files: map[string]string{
+				"plugin.json":                     inspectManifest,
+				"server/dist/plugin-linux-amd64":  "linux",
+				"server/dist/plugin-darwin-amd64": "darwin",
+				"webapp/dist/main.js":             webapp,
+			},
+			bundleHash: webappHash,
+		},
+		{
+			name: "missing executable",
+			files: map[string]string{
+				"plugin.json":                    inspectManifest,
+				"server/dist/plugin-linux-amd64": "linux",
+				"webapp/dist/main.js":            webapp,
+			},
+			missing:    []string{"server/dist/plugin-darwin-amd64"},
+			bundleHash: webappHash,
+		},
+		{
+			name: "missing webapp",
+			files: map[string]string{
+				"plugin.json":                     inspectManifest,
+				"server/dist/plugin-linux-amd64":  "linux",
+				"server/dist/plugin-darwin-amd64": "darwin",
+			},
+			missing: []string{"webapp/dist/main.js"},
+		},
+		{
+			name: "mismatched webapp hash",
+			files: map[string]string{
+				"plugin.json":                     inspectManifest,
+				"server/dist/plugin-linux-amd64":  "linux",
+				"server/dist/plugin-darwin-amd64": "darwin",
+				"webapp/dist/main.js":             "console.log('changed');\n",
+			},
+			bundleHash: webappHash,
+			mismatch:   true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "inspect")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			bundlePath := filepath.Join(dir, "com.example.test-0.1.0.tar.gz")
+			writeTestBundle(t, bundlePath, test.files)
+
+			result, err := inspectBundle(bundlePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Id != "com.example.test" || result.Version != "0.1.0" {
+				t.Errorf("expected com.example.test 0.1.0, got %s %s", result.Id, result.Version)
+			}
+			if result.Manifest != "com.example.test/plugin.json" {
+				t.Errorf("expected manifest com.example.test/plugin.json, got %s", result.Manifest)
+			}
+			if !reflect.DeepEqual(result.Missing, test.missing) {
+				t.Errorf("expected missing %q, got %q", test.missing, result.Missing)
+			}
+
+			var platforms []string
+			for _, file := range result.Executables {
+				platforms = append(platforms, file.Platform)
+				if content, ok := test.files[file.Path]; ok && (!file.Found || file.Size != int64(len(content)) || file.Mode != "-rw-r--r--") {
+					t.Errorf("expected %s to be found with size %d and mode -rw-r--r--, got %+v", file.Path, len(content), file)
+				}
+			}
+			if expected := []string{"darwin-amd64", "linux-amd64"}; !reflect.DeepEqual(platforms, expected) {
+				t.Errorf("expected platforms %q, got %q", expected, platforms)
+			}
+
+			if test.mismatch {
+				if result.Webapp.BundleHash == test.bundleHash {
+					t.Errorf("expected the changed webapp not to hash to %s", test.bundleHash)
+				}
+			} else if result.Webapp.BundleHash != test.bundleHash {
+				t.Errorf("expected webapp hash %q, got %q", test.bundleHash, result.Webapp.BundleHash)
+			}
+		})
+	}
+}
+
+func TestInspectCommandMissingFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inspect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundlePath := filepath.Join(dir, "com.example.test-0.1.0.tar.gz")
+	writeTestBundle(t, bundlePath, map[string]string{"plugin.json": inspectManifest})
+
+	p := newProject()
+	p.Root = dir
+	r := &reporter{stdout: ioutil.Discard, stderr: ioutil.Discard}
+
+	if code := exitCode(runCommand(r, p, "inspect", []string{bundlePath})); code != exitCheckFailed {
+		t.Errorf("expected exit code %d for a bundle missing files, got %d", exitCheckFailed, code)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// vendorTrees are the directories, relative to the plugin root, whose Gopkg.lock and vendor
+// directory are scanned for third-party licenses.
+var vendorTrees = []string{"server", "build/manifest"}
+
+// defaultLicenseAllowList are the licenses permitted by default. Each is an identifier as
+// reported by identifyLicense.
+var defaultLicenseAllowList = []string{"Apache-2.0", "BSD-2-Clause", "BSD-3-Clause", "ISC", "MIT", "MPL-2.0"}
+
+// noticePath is where licenses writes the combined attribution file, relative to the plugin
+// root, and where bundle picks it up.
+const noticePath = "NOTICE.txt"
+
+// licenseRule identifies a license by phrases that must all appear in its text, unless one of
+// the licenses it names was already identified: BSD-3-Clause texts also satisfy the
+// BSD-2-Clause rule, and several licenses refer to the GNU General Public License.
+type licenseRule struct {
+	id      string
+	phrases []string
+	unless  []string
+}
+
+// licenseRules are checked in order. Texts matching several rules, such as the dual licensed
+// Mattermost server, are reported as a choice between them.
+var licenseRules = []licenseRule{
+	{"AGPL-3.0", []string{"gnu affero general public license"}, nil},
+	{"AGPL-3.0", []string{"gnu agpl v.3.0"}, nil},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}, nil},
+	{"LGPL", []string{"gnu lesser general public license"}, []string{"MPL-2.0"}},
+	{"GPL", []string{"gnu general public license"}, []string{"AGPL-3.0", "LGPL", "MPL-2.0"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}, nil},
+	{"MIT", []string{"permission is hereby granted, free of charge"}, nil},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}, nil},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}, nil},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}, []string{"BSD-3-Clause"}},
+}
+
+// dependency is a single vendored project and its licenses.
+type dependency struct {
+	// Tree is the vendor tree the project was found in, such as server.
+	Tree     string `json:"tree"`
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	// License combines the license of each file with AND, and alternatives within a single file
+	// with OR.
+	License string   `json:"license"`
+	Files   []string `json:"files"`
+	Allowed bool     `json:"allowed"`
+
+	texts []string
+}
+
+// licensesResult describes every vendored project, and where the combined notice was written.
+type licensesResult struct {
+	Dependencies []*dependency `json:"dependencies"`
+	Notice       string        `json:"notice,omitempty"`
+}
+
+// gopkgLock is the subset of Gopkg.lock describing the locked projects.
+type gopkgLock struct {
+	Projects []struct {
+		Name     string `toml:"name"`
+		Version  string `toml:"version"`
+		Branch   string `toml:"branch"`
+		Revision string `toml:"revision"`
+	} `toml:"projects"`
+}
+
+// collectLicenses finds the license and notice files of every project locked in a vendor
+// tree's Gopkg.lock, or present in its vendor directory, and checks them against allowed.
+func collectLicenses(p *project, allowed []string) ([]*dependency, error) {
+	var dependencies []*dependency
+	for _, tree := range vendorTrees {
+		treeDependencies, err := collectTreeLicenses(p.path(tree), tree)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, treeDependencies...)
+	}
+
+	allowedIds := make(map[string]bool)
+	for _, id := range allowed {
+		allowedIds[id] = true
+	}
+	for _, dependency := range dependencies {
+		dependency.Allowed = licenseAllowed(dependency.License, allowedIds)
+	}
+
+	return dependencies, nil
+}
+
+func collectTreeLicenses(dir, tree string) ([]*dependency, error) {
+	vendorDir := filepath.Join(dir, "vendor")
+	projects := make(map[string]*dependency)
+
+	lockPath := filepath.Join(dir, "Gopkg.lock")
+	data, err := ioutil.ReadFile(lockPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to read %s", lockPath)
+	} else if err == nil {
+		var lock gopkgLock
+		if err := toml.Unmarshal(data, &lock); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", lockPath)
+		}
+		for _, project := range lock.Projects {
+			version := project.Version
+			if version == "" {
+				version = project.Branch
+			}
+			projects[project.Name] = &dependency{Tree: tree, Name: project.Name, Version: version, Revision: project.Revision}
+		}
+	}
+
+	// Projects vendored without dep have no entry in the lock, but are still shipped.
+	err = filepath.Walk(vendorDir, func(walkPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && walkPath == vendorDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || !isLicenseFile(info.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(vendorDir, filepath.Dir(walkPath))
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		// Nested license files, such as those of a project's own vendored code, belong to the
+		// closest enclosing project that is locked.
+		for owner := name; owner != "."; owner = path.Dir(owner) {
+			if projects[owner] != nil {
+				name = owner
+				break
+			}
+		}
+		if projects[name] == nil {
+			projects[name] = &dependency{Tree: tree, Name: name}
+		}
+		projects[name].Files = append(projects[name].Files, filepath.ToSlash(filepath.Join(tree, "vendor", filepath.FromSlash(rel), info.Name())))
+
+		text, err := ioutil.ReadFile(walkPath)
+		if err != nil {
+			return err
+		}
+		projects[name].texts = append(projects[name].texts, string(text))
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", vendorDir)
+	}
+
+	names := make([]string, 0, len(projects))
+	for name := range projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dependencies := make([]*dependency, 0, len(names))
+	for _, name := range names {
+		dependency := projects[name]
+		dependency.License = combineLicenses(dependency.Files, dependency.texts)
+		dependencies = append(dependencies, dependency)
+	}
+
+	return dependencies, nil
+}
+
+// isLicenseFile reports whether the file holds license or attribution text, as opposed to source
+// code that happens to be named after a license.
+func isLicenseFile(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, prefix := range []string{"LICENSE", "LICENCE", "COPYING", "NOTICE"} {
+		if upper == prefix || strings.HasPrefix(upper, prefix+".") || strings.HasPrefix(upper, prefix+"-") {
+			switch path.Ext(upper) {
+			case ".GO", ".SH":
+				return false
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// whitespace collapses runs of whitespace when matching license texts.
+var whitespace = regexp.MustCompile(`\s+`)
+
+// identifyLicense returns the identifiers of the licenses matched by the text, which are
+// alternatives to one another if more than one.
+func identifyLicense(text string) []string {
+	normalized := whitespace.ReplaceAllString(strings.ToLower(text), " ")
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, rule := range licenseRules {
+		matched := true
+		for _, phrase := range rule.phrases {
+			if !strings.Contains(normalized, phrase) {
+				matched = false
+				break
+			}
+		}
+		for _, id := range rule.unless {
+			if seen[id] {
+				matched = false
+			}
+		}
+		if !matched || seen[rule.id] {
+			continue
+		}
+		seen[rule.id] = true
+		ids = append(ids, rule.id)
+	}
+
+	return ids
+}
+
+// combineLicenses describes the licenses of a project's license files. Notice files carry
+// attribution rather than a license, and are ignored unless they are all there is.
+func combineLicenses(files, texts []string) string {
+	var terms []string
+	seen := make(map[string]bool)
+	for i, text := range texts {
+		if strings.HasPrefix(strings.ToUpper(path.Base(files[i])), "NOTICE") {
+			continue
+		}
+
+		term := "unknown"
+		if ids := identifyLicense(text); len(ids) > 0 {
+			term = strings.Join(ids, " OR ")
+		}
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	if len(terms) == 0 {
+		return "none"
+	}
+
+	return strings.Join(terms, " AND ")
+}
+
+// licenseAllowed reports whether every term of the combined license offers an allowed choice.
+func licenseAllowed(license string, allowed map[string]bool) bool {
+	for _, term := range strings.Split(license, " AND ") {
+		var ok bool
+		for _, id := range strings.Split(term, " OR ") {
+			if allowed[id] {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// renderNotice combines the license and notice files of every dependency into a single
+// attribution file.
+func renderNotice(pluginId string, dependencies []*dependency) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s includes the following third-party software.\n", pluginId)
+
+	for _, dependency := range dependencies {
+		fmt.Fprintf(&buf, "\n%s\n\n", strings.Repeat("-", 80))
+		fmt.Fprintf(&buf, "%s", dependency.Name)
+		if dependency.Version != "" {
+			fmt.Fprintf(&buf, " %s", dependency.Version)
+		}
+		fmt.Fprintf(&buf, " (%s)\n", dependency.License)
+
+		for i, text := range dependency.texts {
+			fmt.Fprintf(&buf, "\n%s:\n\n%s\n", path.Base(dependency.Files[i]), strings.TrimSpace(text))
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// writeLicensesTable describes each dependency as a row of a table.
+func writeLicensesTable(w io.Writer, dependencies []*dependency) {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "TREE\tPROJECT\tVERSION\tLICENSE\tALLOWED")
+	for _, dependency := range dependencies {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%t\n", dependency.Tree, dependency.Name, dependency.Version, dependency.License, dependency.Allowed)
+	}
+	table.Flush()
+}
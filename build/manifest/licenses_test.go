@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestIdentifyLicense(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{"unknown", "All rights reserved.", nil},
+		{"mit", "Permission is hereby granted,\n  FREE of charge, to any person", []string{"MIT"}},
+		{"isc", "Permission to use, copy, modify, and/or distribute this software for any purpose with or without fee", []string{"ISC"}},
+		{"apache", "Apache License\nVersion 2.0, January 2004", []string{"Apache-2.0"}},
+		{"bsd 2 clause", "Redistribution and use in source and binary forms, with or without modification", []string{"BSD-2-Clause"}},
+		{"bsd 3 clause", "Redistribution and use in source and binary forms... Neither the name of the copyright holder", []string{"BSD-3-Clause"}},
+		{"gpl", "GNU General Public License", []string{"GPL"}},
+		{"lgpl", "GNU Lesser General Public License, which supplements the GNU General Public License", []string{"LGPL"}},
+		{"mpl mentioning the gpl", "Mozilla Public License Version 2.0, secondary to the GNU General Public License", []string{"MPL-2.0"}},
+		{"agpl", "GNU Affero General Public License, version 3, a GNU General Public License", []string{"AGPL-3.0"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if ids := identifyLicense(test.text); !reflect.DeepEqual(ids, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, ids)
+			}
+		})
+	}
+}
+
+func TestIdentifyVendoredLicenses(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		expected []string
+	}{
+		{"vendor/github.com/blang/semver/LICENSE", []string{"MIT"}},
+		{"vendor/github.com/pkg/errors/LICENSE", []string{"BSD-2-Clause"}},
+		{"vendor/golang.org/x/crypto/LICENSE", []string{"BSD-3-Clause"}},
+		{"vendor/gopkg.in/yaml.v2/LICENSE", []string{"Apache-2.0"}},
+		{"vendor/github.com/mattermost/mattermost-server/LICENSE.txt", []string{"AGPL-3.0", "Apache-2.0"}},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			text, err := ioutil.ReadFile(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := identifyLicense(string(text)); !reflect.DeepEqual(ids, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, ids)
+			}
+		})
+	}
+}
+
+func TestCombineLicenses(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		files    []string
+		texts    []string
+		expected string
+	}{
+		{"none", nil, nil, "none"},
+		{"notice only", []string{"NOTICE"}, []string{"Copyright"}, "none"},
+		{"unknown", []string{"LICENSE"}, []string{"All rights reserved."}, "unknown"},
+		{
+			"dual licensed",
+			[]string{"LICENSE"},
+			[]string{"GNU Affero General Public License ... Apache License, Version 2.0"},
+			"AGPL-3.0 OR Apache-2.0",
+		},
+		{
+			"several files",
+			[]string{"LICENSE", "LICENSE.libyaml", "NOTICE"},
+			[]string{"Apache License, Version 2.0", "Permission is hereby granted, free of charge", "Copyright"},
+			"Apache-2.0 AND MIT",
+		},
+		{
+			"repeated license",
+			[]string{"LICENSE", "COPYING"},
+			[]string{"Permission is hereby granted, free of charge", "Permission is hereby granted, free of charge"},
+			"MIT",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if license := combineLicenses(test.files, test.texts); license != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, license)
+			}
+		})
+	}
+}
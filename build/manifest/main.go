@@ -1,122 +1,1049 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/mattermost/mattermost-server/model"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
-const pluginIdGoFileTemplate = `package main
+const manifestGoFileTemplate = `package main
 
-var manifest = struct {
-	Id      string
-	Version string
-}{
-	Id:      "%s",
-	Version: "%s",
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+var manifest *model.Manifest
+
+// Build metadata, stamped by the linker with the flags from ` + "`" + `build/bin/manifest buildinfo --ldflags` + "`" + `.
+var (
+	buildCommit string
+	buildDirty  string
+	buildTime   string
+)
+
+const manifestStr = ` + "`" + `
+%s
+` + "`" + `
+
+func init() {
+	manifest = model.ManifestFromJson(strings.NewReader(manifestStr))
+	if manifest == nil {
+		panic("failed to decode the embedded plugin manifest")
+	}
 }
 `
 
-const pluginIdJsFileTemplate = `export const id = '%s';
-export const version = '%s';
+const manifestJsFileTemplate = `const manifest = JSON.parse(` + "`" + `
+%s
+` + "`" + `);
+
+export default manifest;
+export const id = manifest.id;
+export const version = manifest.version;
 `
 
 func main() {
-	if len(os.Args) <= 1 {
-		panic("no cmd specified")
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command line, writing results and errors through a reporter, and returns
+// the process exit code.
+func run(args []string) int {
+	r := &reporter{stdout: os.Stdout, stderr: os.Stderr}
+	p := newProject()
+
+	// Global flags precede the command, and apply to every command.
+	flags := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.BoolVar(&r.json, "json", false, "write results and errors as JSON")
+	p.registerFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			flags.SetOutput(os.Stderr)
+			flags.PrintDefaults()
+		}
+		return r.Finish(usageErrorf("%s", err.Error()))
 	}
+	args = flags.Args()
 
-	manifest, err := findManifest()
-	if err != nil {
-		panic("failed to find manifest: " + err.Error())
+	if len(args) == 0 {
+		return r.Finish(usageErrorf("no cmd specified"))
 	}
 
-	cmd := os.Args[1]
+	return r.Finish(runCommand(r, p, args[0], args[1:]))
+}
+
+// runCommand runs a single command with its arguments.
+func runCommand(r *reporter, p *project, cmd string, args []string) error {
 	switch cmd {
-	case "id":
-		dumpPluginId(manifest)
+	case "compat":
+		return runCompat(r, p, args)
+
+	case "diff":
+		return runDiff(r, p, args)
 
-	case "version":
-		dumpPluginVersion(manifest)
+	case "fakeserver":
+		return runFakeServer(r, args)
 
-	case "has_server":
+	case "inspect":
+		// inspect audits a bundle someone else built, independent of any local manifest.
+		if len(args) == 0 {
+			return usageErrorf("no bundle specified to inspect")
+		}
+		result, err := inspectBundle(args[0])
+		if err != nil {
+			return withExitCode(exitManifest, errors.Wrap(err, "failed to inspect bundle"))
+		}
+		r.Result(result, func(w io.Writer) {
+			writeInspectTable(w, result)
+		})
+		if len(result.Missing) > 0 {
+			return withExitCode(exitCheckFailed, errors.Errorf("bundle is missing files named in the manifest: %v", result.Missing))
+		}
+		return nil
+	}
+
+	command, ok := manifestCommands[cmd]
+	if !ok {
+		return usageErrorf("unrecognized command: %s", cmd)
+	}
+
+	manifest, manifestPath, err := findManifest(p, true)
+	if err != nil {
+		return withExitCode(exitManifest, err)
+	}
+
+	return command(r, p, manifest, manifestPath, args)
+}
+
+// manifestCommands are the commands that operate on the project's manifest, which runCommand
+// finds before running them.
+var manifestCommands = map[string]func(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error{
+	"id":         runId,
+	"version":    runVersion,
+	"has_server": runHasServer,
+	"has_webapp": runHasWebapp,
+	"buildinfo":  runBuildInfo,
+	"apply":      runApply,
+	"validate":   runValidate,
+	"convert":    runConvert,
+	"bundle":     runBundle,
+	"bump":       runBump,
+	"i18n":       runI18n,
+	"licenses":   runLicenses,
+	"docs":       runDocs,
+	"config":     runConfig,
+	"sign":       runSign,
+	"verify":     runVerify,
+	"scaffold":   runScaffold,
+	"migrate":    runMigrate,
+	"watch":      runWatch,
+	"deploy":     runDeploy,
+}
+
+// runId writes the plugin id.
+func runId(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	dumpPluginId(r, manifest)
+
+	return nil
+}
+
+// runVersion writes the plugin version.
+func runVersion(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	dumpPluginVersion(r, manifest)
+
+	return nil
+}
+
+// runHasServer reports whether the plugin has a server component.
+func runHasServer(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	r.Result(map[string]bool{"has_server": manifest.HasServer()}, func(w io.Writer) {
 		if manifest.HasServer() {
-			fmt.Printf("true")
+			fmt.Fprintf(w, "true")
 		}
+	})
 
-	case "has_webapp":
+	return nil
+}
+
+// runHasWebapp reports whether the plugin has a webapp component.
+func runHasWebapp(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	r.Result(map[string]bool{"has_webapp": manifest.HasWebapp()}, func(w io.Writer) {
 		if manifest.HasWebapp() {
-			fmt.Printf("true")
+			fmt.Fprintf(w, "true")
 		}
+	})
+
+	return nil
+}
 
-	case "apply":
-		if err := applyManifest(manifest); err != nil {
-			panic("failed to apply manifest: " + err.Error())
+// runBuildInfo reports the build metadata stamped into the server, or the linker flags to stamp it.
+func runBuildInfo(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	info, err := collectBuildInfo(p.Root)
+	if err != nil {
+		return errors.Wrap(err, "failed to collect build info")
+	}
+	if info.Commit == "" {
+		r.Warn("%s is not a git checkout, no commit will be recorded", p.Root)
+	}
+	if len(args) > 0 && args[0] == "--ldflags" {
+		r.Result(map[string]string{"ldflags": info.ldflags()}, func(w io.Writer) {
+			fmt.Fprintln(w, info.ldflags())
+		})
+		return nil
+	}
+	r.Result(info, func(w io.Writer) {
+		fmt.Fprintf(w, "commit: %s\ndirty: %t\nbuild time: %s\n", info.Commit, info.Dirty, info.BuildTime)
+	})
+
+	return nil
+}
+
+// runApply writes the files generated from the manifest, or with --check reports any that are out of date.
+func runApply(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	if len(args) > 0 && args[0] == "--check" {
+		diffs, err := checkManifestApplied(p, manifest)
+		if err != nil {
+			return errors.Wrap(err, "failed to check manifest")
+		}
+		r.Result(map[string][]string{"diffs": diffs}, func(w io.Writer) {
+			for _, diff := range diffs {
+				fmt.Fprint(w, diff)
+			}
+		})
+		if len(diffs) > 0 {
+			return withExitCode(exitCheckFailed, errors.Errorf("%d generated files are out of date, run: make apply", len(diffs)))
 		}
+		return nil
+	}
 
-	default:
-		panic("unrecognized command: " + cmd)
+	result, err := applyManifest(p, manifest)
+	if err != nil {
+		return errors.Wrap(err, "failed to apply manifest")
+	}
+	r.Result(result, nil)
+
+	return nil
+}
+
+// runValidate reports any problems with the manifest.
+func runValidate(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	diagnostics := validateManifest(manifest)
+	r.Result(map[string][]diagnostic{"diagnostics": diagnostics}, func(w io.Writer) {
+		for _, diagnostic := range diagnostics {
+			fmt.Fprintln(w, diagnostic)
+		}
+	})
+	if len(diagnostics) > 0 {
+		return withExitCode(exitCheckFailed, errors.Errorf("found %d problems in %s", len(diagnostics), manifestPath))
+	}
+
+	return nil
+}
+
+// runConvert re-encodes the manifest in the given format.
+func runConvert(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("no format specified for convert, expected json or yaml")
+	}
+	var outputPath string
+	if len(args) > 1 {
+		outputPath = args[1]
+	}
+	data, err := reencodeManifest(manifest, manifestPath, args[0])
+	if err != nil {
+		return errors.Wrap(err, "failed to convert manifest")
+	}
+	return writeOutput(r, outputPath, data)
+}
+
+// runBundle packages the plugin into a bundle.
+func runBundle(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	bundlePath := defaultBundlePath(p, manifest)
+	if len(args) > 0 {
+		bundlePath = args[0]
+	}
+	if err := bundlePlugin(p, manifest, manifestPath, bundlePath); err != nil {
+		return errors.Wrap(err, "failed to bundle plugin")
+	}
+	r.Result(map[string]string{"bundle": bundlePath}, nil)
+
+	return nil
+}
+
+// runBump increments the version in the manifest.
+func runBump(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	if p.GitVersion {
+		return usageErrorf("bump edits the version in the manifest, which --git-version ignores")
+	}
+	if len(args) == 0 {
+		return usageErrorf("no version part specified for bump, expected major, minor, patch or prerelease")
+	}
+	var tag string
+	if len(args) > 1 {
+		tag = args[1]
+	}
+	version, err := bumpManifest(p, manifest, manifestPath, args[0], tag)
+	if err != nil {
+		return errors.Wrap(err, "failed to bump version")
+	}
+	r.Result(map[string]string{"version": version}, func(w io.Writer) {
+		fmt.Fprintln(w, version)
+	})
+
+	return nil
+}
+
+// runI18n extracts the message catalog, or checks it and the locale catalogs.
+func runI18n(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	if len(args) == 0 || (args[0] != "extract" && args[0] != "check") {
+		return usageErrorf("no i18n command specified, expected extract or check")
+	}
+	dir := p.path(defaultI18nDir)
+	if len(args) > 1 {
+		dir = args[1]
+	}
+
+	if args[0] == "extract" {
+		result, err := extractCatalog(manifest, dir)
+		if err != nil {
+			return errors.Wrap(err, "failed to extract messages")
+		}
+		r.Result(result, func(w io.Writer) {
+			fmt.Fprintf(w, "wrote %d messages to %s\n", result.Messages, result.Catalog)
+			writeLocaleReports(w, result)
+		})
+		return nil
+	}
+
+	result, diff, err := checkCatalog(manifest, dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to check messages")
+	}
+	r.Result(map[string]interface{}{"diff": diff, "locales": result.Locales}, func(w io.Writer) {
+		fmt.Fprint(w, diff)
+		writeLocaleReports(w, result)
+	})
+	if diff != "" {
+		return withExitCode(exitCheckFailed, errors.Errorf("%s is out of date, run: build/bin/manifest i18n extract", result.Catalog))
+	}
+	if problems := result.problems(); problems > 0 {
+		return withExitCode(exitCheckFailed, errors.Errorf("found %d missing, stale or outdated translations", problems))
+	}
+
+	return nil
+}
+
+// runLicenses checks the licenses of vendored dependencies and writes the notice file.
+func runLicenses(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	allowList := strings.Join(defaultLicenseAllowList, ",")
+	licensesFlags := flag.NewFlagSet("licenses", flag.ContinueOnError)
+	licensesFlags.SetOutput(ioutil.Discard)
+	licensesFlags.StringVar(&allowList, "allow", allowList, "comma separated licenses to allow")
+	if err := licensesFlags.Parse(args); err != nil {
+		return usageErrorf("%s", err.Error())
+	}
+	outputPath := p.path(noticePath)
+	if licensesFlags.NArg() > 0 {
+		outputPath = licensesFlags.Arg(0)
+	}
+
+	dependencies, err := collectLicenses(p, strings.Split(allowList, ","))
+	if err != nil {
+		return errors.Wrap(err, "failed to collect licenses")
+	}
+
+	var disallowed []string
+	for _, dependency := range dependencies {
+		if !dependency.Allowed {
+			disallowed = append(disallowed, fmt.Sprintf("%s (%s)", dependency.Name, dependency.License))
+		}
+	}
+
+	result := &licensesResult{Dependencies: dependencies}
+	if len(disallowed) == 0 {
+		if err := ioutil.WriteFile(outputPath, renderNotice(manifest.Id, dependencies), 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %s", outputPath)
+		}
+		result.Notice = outputPath
+	}
+	r.Result(result, func(w io.Writer) {
+		writeLicensesTable(w, dependencies)
+		if result.Notice != "" {
+			fmt.Fprintf(w, "\nwrote %s\n", result.Notice)
+		}
+	})
+	if len(disallowed) > 0 {
+		return withExitCode(exitCheckFailed, errors.Errorf("found licenses outside the allow-list: %s", strings.Join(disallowed, ", ")))
+	}
+
+	return nil
+}
+
+// runDocs renders the settings documentation, or with --check reports whether a file is up to date.
+func runDocs(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	if len(args) > 0 && args[0] == "--check" {
+		if len(args) < 2 {
+			return usageErrorf("no docs file specified to check")
+		}
+		upToDate, err := checkDocs(manifest, args[1])
+		if err != nil {
+			return errors.Wrap(err, "failed to check docs")
+		}
+		r.Result(map[string]bool{"up_to_date": upToDate}, nil)
+		if !upToDate {
+			return withExitCode(exitCheckFailed, errors.Errorf("%s is out of date, run: build/bin/manifest docs %s", args[1], args[1]))
+		}
+		return nil
+	}
+
+	var outputPath string
+	if len(args) > 0 {
+		outputPath = args[0]
+	}
+	docs, err := renderDocs(manifest, docsFormat(outputPath))
+	if err != nil {
+		return errors.Wrap(err, "failed to render docs")
+	}
+	return writeOutput(r, outputPath, docs)
+}
+
+// runConfig renders the plugin's config.json fragment.
+func runConfig(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	config, err := renderConfig(manifest, args)
+	if err != nil {
+		return withExitCode(exitUsage, errors.Wrap(err, "failed to render config"))
+	}
+	r.Result(json.RawMessage(config), func(w io.Writer) {
+		w.Write(config)
+	})
+
+	return nil
+}
+
+// runSign signs the bundle with the given private key.
+func runSign(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("no key file specified for sign")
+	}
+	bundlePath := defaultBundlePath(p, manifest)
+	if len(args) > 1 {
+		bundlePath = args[1]
+	}
+
+	statement, err := signBundle(args[0], bundlePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign bundle")
+	}
+	r.Result(statement, func(w io.Writer) {
+		fmt.Fprintf(w, "signed %s as %s\n", bundlePath, signaturePath(bundlePath))
+	})
+
+	return nil
+}
+
+// runVerify checks the bundle's signature against the given public key.
+func runVerify(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("no key file specified for verify")
+	}
+	bundlePath := defaultBundlePath(p, manifest)
+	if len(args) > 1 {
+		bundlePath = args[1]
+	}
+
+	statement, err := verifyBundle(args[0], bundlePath)
+	if err != nil {
+		return withExitCode(exitCheckFailed, errors.Wrap(err, "failed to verify bundle"))
+	}
+	r.Result(statement, func(w io.Writer) {
+		fmt.Fprintf(w, "verified %s %s in %s\n", statement.PluginId, statement.Version, bundlePath)
+	})
+
+	return nil
+}
+
+// runScaffold creates any missing server files for the settings in the manifest.
+func runScaffold(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	result, err := scaffoldServer(p, manifest)
+	if err != nil {
+		return errors.Wrap(err, "failed to scaffold server")
+	}
+	r.Result(result, func(w io.Writer) {
+		for _, path := range result.Created {
+			fmt.Fprintf(w, "created %s\n", path)
+		}
+		for _, path := range result.Skipped {
+			fmt.Fprintf(w, "skipped %s, it already exists\n", path)
+		}
+		for _, path := range result.Generated {
+			fmt.Fprintf(w, "generated %s\n", path)
+		}
+	})
+
+	return nil
+}
+
+// runMigrate upgrades deprecated manifest fields.
+func runMigrate(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	if p.GitVersion {
+		return usageErrorf("migrate rewrites the manifest, which would record the version derived by --git-version")
+	}
+	migrateFlags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	migrateFlags.SetOutput(ioutil.Discard)
+	minServerVersion := migrateFlags.String("min-server-version", model.CurrentVersion, "min_server_version to set when missing")
+	if err := migrateFlags.Parse(args); err != nil {
+		return usageErrorf("%s", err.Error())
+	}
+	migrations, err := migrateManifest(p, manifest, manifestPath, *minServerVersion)
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate manifest")
+	}
+	r.Result(map[string][]migration{"migrations": migrations}, func(w io.Writer) {
+		if len(migrations) == 0 {
+			fmt.Fprintf(w, "%s is up to date\n", manifestPath)
+			return
+		}
+		for _, m := range migrations {
+			fmt.Fprintf(w, "%s: %s\n", m.Field, m.Message)
+		}
+	})
+
+	return nil
+}
+
+// runWatch rebuilds, and optionally deploys, the plugin whenever its sources change.
+func runWatch(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	options := watchOptions{Interval: 250 * time.Millisecond, Debounce: 500 * time.Millisecond, Deploy: true}
+	watchFlags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	watchFlags.SetOutput(ioutil.Discard)
+	watchFlags.DurationVar(&options.Interval, "interval", options.Interval, "how often to poll for changes")
+	watchFlags.DurationVar(&options.Debounce, "debounce", options.Debounce, "how long files must stay unchanged before rebuilding")
+	watchFlags.BoolVar(&options.Deploy, "deploy", options.Deploy, "deploy after each rebuild when credentials are configured")
+	if err := watchFlags.Parse(args); err != nil {
+		return usageErrorf("%s", err.Error())
+	}
+	if options.Interval <= 0 {
+		return usageErrorf("watch interval must be positive")
+	}
+	if err := watchPlugin(r, p, manifestPath, options); err != nil {
+		return errors.Wrap(err, "failed to watch plugin")
+	}
+
+	return nil
+}
+
+// runDeploy uploads the bundle to the server and enables the plugin.
+func runDeploy(r *reporter, p *project, manifest *model.Manifest, manifestPath string, args []string) error {
+	bundlePath := defaultBundlePath(p, manifest)
+	if len(args) > 0 {
+		bundlePath = args[0]
+	}
+	config := deployConfigFromEnv()
+	if err := deployPlugin(config, manifest.Id, bundlePath); err != nil {
+		return withExitCode(exitRemote, errors.Wrap(err, "failed to deploy plugin"))
 	}
+	r.Result(map[string]string{"id": manifest.Id, "site_url": config.SiteURL}, func(w io.Writer) {
+		fmt.Fprintf(w, "deployed %s to %s\n", manifest.Id, config.SiteURL)
+	})
+
+	return nil
 }
 
-func findManifest() (*model.Manifest, error) {
-	_, manifestFilePath, err := model.FindManifest(".")
+// runCompat checks the manifest against the server version given in args, or else reported by
+// the server at MM_SERVICESETTINGS_SITEURL.
+func runCompat(r *reporter, p *project, args []string) error {
+	// compat is meant for manifests targeting other server versions, so unlike every other
+	// command it tolerates fields the vendored model doesn't know.
+	manifest, manifestPath, err := findManifest(p, false)
+	if err != nil {
+		return withExitCode(exitManifest, err)
+	}
+
+	var serverVersion string
+	if len(args) > 0 {
+		serverVersion = args[0]
+	} else if siteURL := os.Getenv("MM_SERVICESETTINGS_SITEURL"); siteURL != "" {
+		if serverVersion, err = queryServerVersion(siteURL); err != nil {
+			return withExitCode(exitRemote, errors.Wrap(err, "failed to query server version"))
+		}
+	} else {
+		return usageErrorf("no server version specified, pass one or set MM_SERVICESETTINGS_SITEURL")
+	}
+
+	result, err := checkCompat(manifest, manifestPath, serverVersion)
+	if err != nil {
+		return err
+	}
+
+	for _, warning := range result.Warnings {
+		r.Warn("%s", warning)
+	}
+	r.Result(result, func(w io.Writer) {
+		if result.Compatible {
+			fmt.Fprintf(w, "server %s is compatible\n", result.ServerVersion)
+		}
+	})
+	if !result.Compatible {
+		return withExitCode(exitCheckFailed, errors.Errorf("server %s does not satisfy min_server_version %s", result.ServerVersion, result.MinServerVersion))
+	}
+
+	return nil
+}
+
+// runDiff compares an earlier manifest, or the manifest in an earlier bundle, with the given
+// manifest or the project's own, writing upgrade notes in Markdown.
+func runDiff(r *reporter, p *project, args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("no old manifest or bundle specified to diff")
+	}
+
+	var oldManifest *model.Manifest
+	if strings.HasSuffix(args[0], ".tar.gz") || strings.HasSuffix(args[0], ".tgz") {
+		bundle, err := readBundleManifest(args[0])
+		if err != nil {
+			return withExitCode(exitManifest, err)
+		}
+		oldManifest = bundle.Manifest
+	} else {
+		// The earlier manifest's version is its own, whatever the current checkout is tagged.
+		old := *p
+		old.ManifestPath = args[0]
+		old.GitVersion = false
+		manifest, _, err := findManifest(&old, true)
+		if err != nil {
+			return withExitCode(exitManifest, err)
+		}
+		oldManifest = manifest
+	}
+
+	current := *p
+	if len(args) > 1 {
+		current.ManifestPath = args[1]
+	}
+	newManifest, _, err := findManifest(&current, true)
+	if err != nil {
+		return withExitCode(exitManifest, err)
+	}
+
+	diff, err := diffManifests(oldManifest, newManifest)
+	if err != nil {
+		return errors.Wrap(err, "failed to compare manifests")
+	}
+	notes, err := renderUpgradeNotes(diff)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to find manifest in current working directory")
+		return err
+	}
+
+	r.Result(diff, func(w io.Writer) {
+		w.Write(notes)
+	})
+	if len(diff.Breaking) > 0 {
+		return withExitCode(exitCheckFailed, errors.Errorf("found %d breaking changes", len(diff.Breaking)))
+	}
+
+	return nil
+}
+
+// findManifest locates, decodes and returns the project's manifest along with the path it was
+// read from. Unless strict is false, fields unknown to the vendored model are rejected.
+func findManifest(p *project, strict bool) (*model.Manifest, string, error) {
+	manifestFilePath, err := p.findManifestPath()
+	if err != nil {
+		return nil, "", err
 	}
 	manifestFile, err := os.Open(manifestFilePath)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to open %s", manifestFilePath)
+		return nil, "", errors.Wrapf(err, "failed to open %s", manifestFilePath)
 	}
 	defer manifestFile.Close()
 
-	// Re-decode the manifest, disallowing unknown fields. When we write the manifest back out,
-	// we don't want to accidentally clobber anything we won't preserve.
+	manifest, err := decodeManifest(manifestFile, manifestFormat(manifestFilePath), strict)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to parse %s", manifestFilePath)
+	}
+
+	if p.GitVersion {
+		version, err := describeVersion(p.Root, manifest.Version)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "failed to derive version from git")
+		}
+		manifest.Version = version
+	}
+
+	return manifest, manifestFilePath, nil
+}
+
+// manifestFormat returns the encoding of the manifest at the given path, "yaml" for plugin.yml
+// and plugin.yaml, and "json" otherwise.
+func manifestFormat(path string) string {
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		return "yaml"
+	default:
+		return "json"
+	}
+}
+
+// parseManifestDocument parses the manifest in the given format without decoding it into
+// model.Manifest, keeping any fields the model doesn't know. Objects are decoded as yaml.MapSlice
+// in either format, preserving the order of their keys.
+func parseManifestDocument(data []byte, format string) (yaml.MapSlice, error) {
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		value, err := decodeOrderedJSON(decoder)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, errors.New("unexpected data after the manifest object")
+		}
+		document, ok := value.(yaml.MapSlice)
+		if !ok {
+			return nil, errors.New("manifest is not a JSON object")
+		}
+		return document, nil
+
+	case "yaml":
+		var document yaml.MapSlice
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+		return document, nil
+
+	default:
+		return nil, errors.Errorf("unsupported manifest format %s", format)
+	}
+}
+
+// decodeOrderedJSON decodes the next JSON value from decoder, with objects as yaml.MapSlice.
+func decodeOrderedJSON(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := yaml.MapSlice{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, yaml.MapItem{Key: key, Value: value})
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return object, nil
+
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return array, nil
+
+	default:
+		return token, nil
+	}
+}
+
+// decodeManifest re-decodes the manifest in the given format. When strict, unknown fields are
+// disallowed: when we write the manifest back out, we don't want to accidentally clobber
+// anything we won't preserve.
+func decodeManifest(r io.Reader, format string, strict bool) (*model.Manifest, error) {
 	var manifest model.Manifest
-	decoder := json.NewDecoder(manifestFile)
-	decoder.DisallowUnknownFields()
-	if err = decoder.Decode(&manifest); err != nil {
-		return nil, errors.Wrap(err, "failed to parse manifest")
+
+	// Executables for platforms the vendored model doesn't know are still permitted, since newer
+	// servers recognise them. reencodeManifest restores them when the manifest is rewritten.
+	if strict {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		data, err = stripPlatformExecutables(data, format)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(r)
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(&manifest); err != nil {
+			return nil, err
+		}
+
+	case "yaml":
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		unmarshal := yaml.Unmarshal
+		if strict {
+			unmarshal = yaml.UnmarshalStrict
+		}
+		if err := unmarshal(data, &manifest); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errors.Errorf("unsupported manifest format %s", format)
 	}
 
 	return &manifest, nil
 }
 
+// model.ManifestServer doesn't omit an empty executable, which is redundant alongside the
+// per-platform executables.
+var (
+	emptyExecutableJSON = regexp.MustCompile(`,\n\s*"executable": ""`)
+	emptyExecutableYAML = regexp.MustCompile(`(?m)^\s*executable: ""\n`)
+)
+
+// encodeManifest serializes the manifest in the given format.
+//
+// YAML is produced from the JSON encoding so that both formats share the same field names, key
+// order and omitempty rules, and converting back and forth doesn't lose or invent any fields.
+func encodeManifest(manifest *model.Manifest, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+
+	switch format {
+	case "json":
+		return emptyExecutableJSON.ReplaceAll(append(data, '\n'), nil), nil
+
+	case "yaml":
+		var fields yaml.MapSlice
+		if err := yaml.Unmarshal(data, &fields); err != nil {
+			return nil, errors.Wrap(err, "failed to convert manifest to yaml")
+		}
+		data, err := yaml.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		return emptyExecutableYAML.ReplaceAll(data, nil), nil
+
+	default:
+		return nil, errors.Errorf("unsupported manifest format %s", format)
+	}
+}
+
+// reencodeManifest encodes the manifest decoded from manifestPath in the given format, keeping
+// the executables decodeManifest strips for platforms the vendored model doesn't define.
+func reencodeManifest(manifest *model.Manifest, manifestPath, format string) ([]byte, error) {
+	original, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", manifestPath)
+	}
+
+	data, err := encodeManifest(manifest, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return restorePlatformExecutables(data, format, original, manifestFormat(manifestPath))
+}
+
 // dumpPluginId writes the plugin id from the given manifest to standard out
-func dumpPluginId(manifest *model.Manifest) {
-	fmt.Printf("%s", manifest.Id)
+func dumpPluginId(r *reporter, manifest *model.Manifest) {
+	r.Result(map[string]string{"id": manifest.Id}, func(w io.Writer) {
+		fmt.Fprintf(w, "%s", manifest.Id)
+	})
 }
 
 // dumpPluginVersion writes the plugin version from the given manifest to standard out
-func dumpPluginVersion(manifest *model.Manifest) {
-	fmt.Printf("%s", manifest.Version)
+func dumpPluginVersion(r *reporter, manifest *model.Manifest) {
+	r.Result(map[string]string{"version": manifest.Version}, func(w io.Writer) {
+		fmt.Fprintf(w, "%s", manifest.Version)
+	})
+}
+
+// generatedFile is a file rendered from the manifest.
+type generatedFile struct {
+	Path    string
+	Content []byte
+}
+
+// applyResult lists the generated files apply wrote or found up to date.
+type applyResult struct {
+	Written   []string `json:"written"`
+	Unchanged []string `json:"unchanged"`
 }
 
-// applyManifest propagates the plugin_id into the server and webapp folders, as necessary
-func applyManifest(manifest *model.Manifest) error {
+// applyManifest propagates the plugin manifest into the server and webapp folders, as necessary,
+// and generates the server configuration struct from the settings schema. Files whose content
+// is already up to date are left untouched, so that their mtimes don't trigger rebuilds.
+func applyManifest(p *project, manifest *model.Manifest) (*applyResult, error) {
+	files, err := renderGeneratedFiles(p, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &applyResult{}
+	for _, file := range files {
+		existing, err := ioutil.ReadFile(file.Path)
+		if err == nil && bytes.Equal(existing, file.Content) {
+			result.Unchanged = append(result.Unchanged, file.Path)
+			continue
+		}
+
+		if err := ioutil.WriteFile(file.Path, file.Content, 0644); err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s", file.Path)
+		}
+		result.Written = append(result.Written, file.Path)
+	}
+
+	return result, nil
+}
+
+// checkManifestApplied renders the generated files in memory and returns a unified diff for
+// each file that differs from what is on disk.
+func checkManifestApplied(p *project, manifest *model.Manifest) ([]string, error) {
+	files, err := renderGeneratedFiles(p, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	for _, file := range files {
+		existing, err := ioutil.ReadFile(file.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to read %s", file.Path)
+		}
+
+		if diff := unifiedDiff(file.Path, file.Path, existing, file.Content); diff != "" {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs, nil
+}
+
+// renderGeneratedFiles renders every file apply is responsible for.
+func renderGeneratedFiles(p *project, manifest *model.Manifest) ([]generatedFile, error) {
+	var files []generatedFile
+
+	// With a platform matrix configured, the files below are rendered from the manifest as it is
+	// bundled, naming the executable for each platform built. The manifest itself is left as
+	// written.
+	if manifest.HasServer() && p.Platforms != nil {
+		manifestPath, err := p.findManifestPath()
+		if err != nil {
+			return nil, err
+		}
+		data, err := bundledManifest(p, manifest, manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err = decodeManifest(bytes.NewReader(data), manifestFormat(manifestPath), true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", manifestPath)
+		}
+	}
+
 	if manifest.HasServer() {
-		if err := ioutil.WriteFile(
-			"server/manifest.go",
-			[]byte(fmt.Sprintf(pluginIdGoFileTemplate, manifest.Id, manifest.Version)),
-			0644,
-		); err != nil {
-			return errors.Wrap(err, "failed to write server/manifest.go")
+		serverManifest, err := renderServerManifest(manifest)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, generatedFile{Path: p.path(p.ServerManifestPath), Content: serverManifest})
+
+		configuration, err := generateConfiguration(manifest)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate server configuration")
 		}
+		files = append(files, generatedFile{Path: p.path(p.ServerConfigurationPath), Content: configuration})
 	}
 
 	if manifest.HasWebapp() {
-		if err := ioutil.WriteFile(
-			"webapp/src/manifest.js",
-			[]byte(fmt.Sprintf(pluginIdJsFileTemplate, manifest.Id, manifest.Version)),
-			0644,
-		); err != nil {
-			return errors.Wrap(err, "failed to open webapp/src/manifest.js")
+		webappManifest, err := renderWebappManifest(manifest)
+		if err != nil {
+			return nil, err
 		}
+		files = append(files, generatedFile{Path: p.path(p.WebappManifestPath), Content: webappManifest})
+	}
+
+	return files, nil
+}
+
+// renderServerManifest renders server/manifest.go, embedding the whole manifest so that the
+// server can parse it at startup.
+func renderServerManifest(manifest *model.Manifest) ([]byte, error) {
+	manifestStr, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+
+	// A Go raw string literal cannot contain a backtick, so splice any in as interpreted strings.
+	escaped := strings.Replace(string(manifestStr), "`", "` + \"`\" + `", -1)
+
+	return []byte(fmt.Sprintf(manifestGoFileTemplate, escaped)), nil
+}
+
+// renderWebappManifest renders webapp/src/manifest.js, exporting the whole manifest as an object
+// alongside the id and version.
+func renderWebappManifest(manifest *model.Manifest) ([]byte, error) {
+	manifestStr, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+
+	// Escape the JSON so that the template literal evaluates back to exactly the same text.
+	escaped := strings.NewReplacer("\\", "\\\\", "`", "\\`", "${", "\\${").Replace(string(manifestStr))
+
+	return []byte(fmt.Sprintf(manifestJsFileTemplate, escaped)), nil
+}
+
+// writeOutput writes data to outputPath, or to standard out if no output path is given. In JSON
+// mode, data written to standard out is reported as the result's content instead.
+func writeOutput(r *reporter, outputPath string, data []byte) error {
+	if outputPath == "" {
+		r.Result(map[string]string{"content": string(data)}, func(w io.Writer) {
+			w.Write(data)
+		})
+		return nil
+	}
+
+	if err := ioutil.WriteFile(outputPath, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s", outputPath)
 	}
+	r.Result(map[string]string{"path": outputPath}, nil)
 
 	return nil
 }
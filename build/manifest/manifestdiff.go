@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// valueChange is a single field whose value differs between two manifests. A nil value is
+// absent from that manifest.
+type valueChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// settingDiff describes a setting added, removed or changed between two manifests.
+type settingDiff struct {
+	Key     string      `json:"key"`
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Default interface{} `json:"default,omitempty"`
+	// Changes lists the setting's fields that changed, other than its options.
+	Changes        []valueChange `json:"changes,omitempty"`
+	AddedOptions   []string      `json:"added_options,omitempty"`
+	RemovedOptions []string      `json:"removed_options,omitempty"`
+}
+
+// manifestDiff describes the changes from one manifest to another, as seen by an administrator
+// upgrading the plugin. Breaking changes are those that may invalidate a configured value.
+type manifestDiff struct {
+	Title      string         `json:"title"`
+	OldVersion string         `json:"old_version"`
+	NewVersion string         `json:"new_version"`
+	Fields     []valueChange  `json:"fields"`
+	Added      []*settingDiff `json:"added"`
+	Removed    []*settingDiff `json:"removed"`
+	Changed    []*settingDiff `json:"changed"`
+	Breaking   []string       `json:"breaking"`
+}
+
+// diffManifests compares every field of the two manifests. Settings are matched by key rather
+// than position, and their options by value.
+func diffManifests(oldManifest, newManifest *model.Manifest) (*manifestDiff, error) {
+	diff := &manifestDiff{
+		Title:      newManifest.Id,
+		OldVersion: oldManifest.Version,
+		NewVersion: newManifest.Version,
+		Fields:     []valueChange{},
+		Added:      []*settingDiff{},
+		Removed:    []*settingDiff{},
+		Changed:    []*settingDiff{},
+		Breaking:   []string{},
+	}
+	if newManifest.Name != "" {
+		diff.Title = newManifest.Name
+	}
+
+	oldFields, err := flattenManifest(oldManifest)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := flattenManifest(newManifest)
+	if err != nil {
+		return nil, err
+	}
+	diff.Fields = diffValues(oldFields, newFields)
+
+	oldSettings := manifestSettings(oldManifest)
+	newSettings := manifestSettings(newManifest)
+
+	oldByKey := make(map[string]*model.PluginSetting)
+	for _, setting := range oldSettings {
+		oldByKey[setting.Key] = setting
+	}
+	newByKey := make(map[string]*model.PluginSetting)
+	for _, setting := range newSettings {
+		newByKey[setting.Key] = setting
+	}
+
+	for _, setting := range oldSettings {
+		if newByKey[setting.Key] == nil {
+			diff.Removed = append(diff.Removed, newSettingDiff(setting))
+			diff.Breaking = append(diff.Breaking, fmt.Sprintf("Setting `%s` was removed.", setting.Key))
+		}
+	}
+
+	for _, setting := range newSettings {
+		oldSetting := oldByKey[setting.Key]
+		if oldSetting == nil {
+			diff.Added = append(diff.Added, newSettingDiff(setting))
+			continue
+		}
+
+		changed, err := diffSetting(oldSetting, setting)
+		if err != nil {
+			return nil, err
+		}
+		if changed == nil {
+			continue
+		}
+		diff.Changed = append(diff.Changed, changed)
+
+		// A value chosen from the old options is only invalidated if the setting still offers a
+		// choice; a changed type is reported on its own.
+		if oldSetting.Type != setting.Type {
+			diff.Breaking = append(diff.Breaking, fmt.Sprintf("Setting `%s` changed type from `%s` to `%s`.", setting.Key, oldSetting.Type, setting.Type))
+		} else {
+			for _, value := range changed.RemovedOptions {
+				diff.Breaking = append(diff.Breaking, fmt.Sprintf("Setting `%s` no longer allows `%s`.", setting.Key, value))
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// manifestSettings returns the settings of the manifest that have a key.
+func manifestSettings(manifest *model.Manifest) []*model.PluginSetting {
+	if manifest.SettingsSchema == nil {
+		return nil
+	}
+
+	var settings []*model.PluginSetting
+	for _, setting := range manifest.SettingsSchema.Settings {
+		if setting != nil && setting.Key != "" {
+			settings = append(settings, setting)
+		}
+	}
+
+	return settings
+}
+
+func newSettingDiff(setting *model.PluginSetting) *settingDiff {
+	name := setting.DisplayName
+	if name == "" {
+		name = setting.Key
+	}
+
+	return &settingDiff{Key: setting.Key, Name: name, Type: setting.Type, Default: setting.Default}
+}
+
+// diffSetting returns the changes to a setting, or nil if there are none.
+func diffSetting(oldSetting, newSetting *model.PluginSetting) (*settingDiff, error) {
+	diff := newSettingDiff(newSetting)
+
+	oldFields, err := flattenSetting(oldSetting)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := flattenSetting(newSetting)
+	if err != nil {
+		return nil, err
+	}
+	diff.Changes = diffValues(oldFields, newFields)
+
+	oldOptions := make(map[string]string)
+	for _, option := range oldSetting.Options {
+		if option != nil {
+			oldOptions[option.Value] = option.DisplayName
+		}
+	}
+	newOptions := make(map[string]bool)
+	for _, option := range newSetting.Options {
+		if option == nil {
+			continue
+		}
+		newOptions[option.Value] = true
+
+		displayName, ok := oldOptions[option.Value]
+		if !ok {
+			diff.AddedOptions = append(diff.AddedOptions, option.Value)
+		} else if displayName != option.DisplayName {
+			diff.Changes = append(diff.Changes, valueChange{"options." + option.Value + ".display_name", displayName, option.DisplayName})
+		}
+	}
+	for _, option := range oldSetting.Options {
+		if option != nil && !newOptions[option.Value] {
+			diff.RemovedOptions = append(diff.RemovedOptions, option.Value)
+		}
+	}
+
+	if len(diff.Changes) == 0 && len(diff.AddedOptions) == 0 && len(diff.RemovedOptions) == 0 {
+		return nil, nil
+	}
+
+	return diff, nil
+}
+
+// flattenManifest returns the manifest's fields other than its settings, keyed by their dotted
+// JSON path, such as server.executables.linux-amd64.
+func flattenManifest(manifest *model.Manifest) (map[string]interface{}, error) {
+	withoutSettings := *manifest
+	if manifest.SettingsSchema != nil {
+		schema := *manifest.SettingsSchema
+		schema.Settings = nil
+		withoutSettings.SettingsSchema = &schema
+	}
+
+	return flattenValue(withoutSettings)
+}
+
+// flattenSetting returns the setting's fields other than its key and options, keyed by their
+// dotted JSON path.
+func flattenSetting(setting *model.PluginSetting) (map[string]interface{}, error) {
+	withoutOptions := *setting
+	withoutOptions.Options = nil
+
+	fields, err := flattenValue(withoutOptions)
+	if err != nil {
+		return nil, err
+	}
+	delete(fields, "key")
+
+	return fields, nil
+}
+
+// flattenValue encodes value as JSON, so that values decoded from JSON and YAML compare equal,
+// and collects its leaves.
+func flattenValue(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode manifest")
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, errors.Wrap(err, "failed to decode manifest")
+	}
+
+	fields := make(map[string]interface{})
+	var collect func(prefix string, value interface{})
+	collect = func(prefix string, value interface{}) {
+		switch value := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			for key, child := range value {
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				collect(key, child)
+			}
+		default:
+			fields[prefix] = value
+		}
+	}
+	collect("", decoded)
+
+	return fields, nil
+}
+
+// diffValues returns the fields whose values differ, sorted by field.
+func diffValues(oldFields, newFields map[string]interface{}) []valueChange {
+	names := make(map[string]bool)
+	for name := range oldFields {
+		names[name] = true
+	}
+	for name := range newFields {
+		names[name] = true
+	}
+
+	changes := []valueChange{}
+	for name := range names {
+		oldValue, _ := json.Marshal(oldFields[name])
+		newValue, _ := json.Marshal(newFields[name])
+		if !bytes.Equal(oldValue, newValue) {
+			changes = append(changes, valueChange{name, oldFields[name], newFields[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes
+}
+
+const upgradeNotesTemplate = `# Upgrading {{.Title}} from {{.OldVersion}} to {{.NewVersion}}
+{{if not (or .Fields .Added .Removed .Changed)}}
+No changes.
+{{end}}{{with .Breaking}}
+## Breaking changes
+{{range .}}
+- {{.}}
+{{- end}}
+{{end}}{{with .Fields}}
+## Manifest
+
+| Field | Old | New |
+| --- | --- | --- |
+{{range .}}| ` + "`{{.Field}}`" + ` | {{cell (value .Old)}} | {{cell (value .New)}} |
+{{end}}{{end}}{{with .Added}}
+## Added settings
+{{range .}}
+- ` + "`{{.Key}}`" + `, {{.Name}}: {{.Type}}, default {{value .Default}}
+{{- end}}
+{{end}}{{with .Removed}}
+## Removed settings
+{{range .}}
+- ` + "`{{.Key}}`" + `, {{.Name}}
+{{- end}}
+{{end}}{{with .Changed}}
+## Changed settings
+{{range .}}
+### ` + "`{{.Key}}`" + `, {{.Name}}
+{{range .Changes}}
+- {{.Field}}: {{value .Old}} to {{value .New}}
+{{- end}}
+{{- with .AddedOptions}}
+- Added options: {{options .}}
+{{- end}}
+{{- with .RemovedOptions}}
+- Removed options: {{options .}}
+{{- end}}
+{{end}}{{end}}`
+
+var upgradeNotes = template.Must(template.New("upgrade").Funcs(map[string]interface{}{
+	"value": func(value interface{}) string {
+		switch value := value.(type) {
+		case nil:
+			return "none"
+		case string:
+			if value == "" {
+				return "empty"
+			}
+			return "`" + value + "`"
+		default:
+			data, _ := json.Marshal(value)
+			return "`" + string(data) + "`"
+		}
+	},
+	// cell escapes the pipes separating table cells, which Markdown honours even in code.
+	"cell": func(text string) string {
+		return strings.Replace(text, "|", "\\|", -1)
+	},
+	"options": func(values []string) string {
+		return "`" + strings.Join(values, "`, `") + "`"
+	},
+}).Parse(upgradeNotesTemplate))
+
+// renderUpgradeNotes describes the diff in Markdown, for administrators upgrading the plugin.
+func renderUpgradeNotes(diff *manifestDiff) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := upgradeNotes.Execute(&buf, diff); err != nil {
+		return nil, errors.Wrap(err, "failed to render upgrade notes")
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// diffTestManifest returns a manifest with the given settings.
+func diffTestManifest(version string, settings ...*model.PluginSetting) *model.Manifest {
+	return &model.Manifest{
+		Id:             "com.example.test",
+		Name:           "Example",
+		Version:        version,
+		SettingsSchema: &model.PluginSettingsSchema{Settings: settings},
+	}
+}
+
+func diffTestOptions(values ...string) []*model.PluginOption {
+	var options []*model.PluginOption
+	for _, value := range values {
+		options = append(options, &model.PluginOption{DisplayName: value, Value: value})
+	}
+
+	return options
+}
+
+func TestDiffManifests(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		old, new    *model.Manifest
+		fields      []string
+		added       []string
+		removed     []string
+		changed     []string
+		breaking    []string
+		changes     []string
+		addedOpts   []string
+		removedOpts []string
+	}{
+		{
+			name: "no changes",
+			old:  diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "text"}),
+			new:  diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "text"}),
+		},
+		{
+			name:   "manifest fields",
+			old:    diffTestManifest("0.1.0"),
+			new:    &model.Manifest{Id: "com.example.test", Name: "Example", Version: "0.2.0", MinServerVersion: "5.6.0", SettingsSchema: &model.PluginSettingsSchema{}},
+			fields: []string{"min_server_version", "version"},
+		},
+		{
+			name: "settings matched by key",
+			old:  diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "text"}, &model.PluginSetting{Key: "b", Type: "bool"}),
+			new:  diffTestManifest("0.1.0", &model.PluginSetting{Key: "b", Type: "bool"}, &model.PluginSetting{Key: "a", Type: "text"}),
+		},
+		{
+			name:  "added setting",
+			old:   diffTestManifest("0.1.0"),
+			new:   diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "text"}),
+			added: []string{"a"},
+		},
+		{
+			name:     "removed setting",
+			old:      diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "text"}, &model.PluginSetting{Key: "b", Type: "text"}),
+			new:      diffTestManifest("0.1.0", &model.PluginSetting{Key: "b", Type: "text"}),
+			removed:  []string{"a"},
+			breaking: []string{"Setting `a` was removed."},
+		},
+		{
+			name:     "changed type",
+			old:      diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "dropdown", Options: diffTestOptions("x", "y")}),
+			new:      diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "text"}),
+			changed:  []string{"a"},
+			breaking: []string{"Setting `a` changed type from `dropdown` to `text`."},
+			// The removed options are listed, but not reported as breaking on top of the type.
+			changes:     []string{"type"},
+			removedOpts: []string{"x", "y"},
+		},
+		{
+			name:        "removed options",
+			old:         diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "radio", Options: diffTestOptions("x", "y", "z")}),
+			new:         diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "radio", Options: diffTestOptions("y", "w")}),
+			changed:     []string{"a"},
+			breaking:    []string{"Setting `a` no longer allows `x`.", "Setting `a` no longer allows `z`."},
+			addedOpts:   []string{"w"},
+			removedOpts: []string{"x", "z"},
+		},
+		{
+			name: "added options",
+			old:  diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "dropdown", Options: diffTestOptions("x")}),
+			new: diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "dropdown", Options: []*model.PluginOption{
+				{DisplayName: "Ex", Value: "x"},
+				{DisplayName: "Why", Value: "y"},
+			}}),
+			changed:   []string{"a"},
+			changes:   []string{"options.x.display_name"},
+			addedOpts: []string{"y"},
+		},
+		{
+			name:    "changed default",
+			old:     diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "bool", Default: false}),
+			new:     diffTestManifest("0.1.0", &model.PluginSetting{Key: "a", Type: "bool", Default: true}),
+			changed: []string{"a"},
+			changes: []string{"default"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			diff, err := diffManifests(test.old, test.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var fields []string
+			for _, field := range diff.Fields {
+				fields = append(fields, field.Field)
+			}
+			keys := func(settings []*settingDiff) []string {
+				var keys []string
+				for _, setting := range settings {
+					keys = append(keys, setting.Key)
+				}
+				return keys
+			}
+
+			for _, check := range []struct {
+				name             string
+				expected, actual []string
+			}{
+				{"fields", test.fields, fields},
+				{"added settings", test.added, keys(diff.Added)},
+				{"removed settings", test.removed, keys(diff.Removed)},
+				{"changed settings", test.changed, keys(diff.Changed)},
+				{"breaking changes", test.breaking, diff.Breaking},
+			} {
+				if len(check.expected) > 0 || len(check.actual) > 0 {
+					if !reflect.DeepEqual(check.actual, check.expected) {
+						t.Errorf("expected %s %q, got %q", check.name, check.expected, check.actual)
+					}
+				}
+			}
+
+			if len(diff.Changed) != 1 {
+				return
+			}
+			var changes []string
+			for _, change := range diff.Changed[0].Changes {
+				changes = append(changes, change.Field)
+			}
+			if !reflect.DeepEqual(changes, test.changes) {
+				t.Errorf("expected setting changes %q, got %q", test.changes, changes)
+			}
+			if !reflect.DeepEqual(diff.Changed[0].AddedOptions, test.addedOpts) {
+				t.Errorf("expected added options %q, got %q", test.addedOpts, diff.Changed[0].AddedOptions)
+			}
+			if !reflect.DeepEqual(diff.Changed[0].RemovedOptions, test.removedOpts) {
+				t.Errorf("expected removed options %q, got %q", test.removedOpts, diff.Changed[0].RemovedOptions)
+			}
+		})
+	}
+}
+
+func TestRenderUpgradeNotes(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		old, new *model.Manifest
+	}{
+		{
+			name: "upgrade_notes.md",
+			old: &model.Manifest{
+				Id:          "com.example.test",
+				Name:        "Example",
+				Version:     "0.1.0",
+				Description: "Posts a|b",
+				SettingsSchema: &model.PluginSettingsSchema{Settings: []*model.PluginSetting{
+					{Key: "Mode", DisplayName: "Mode", Type: "dropdown", Default: "fast", Options: diffTestOptions("fast", "slow|safe")},
+					{Key: "Legacy", DisplayName: "Legacy", Type: "bool"},
+					{Key: "Limit", Type: "text", Default: "10"},
+				}},
+			},
+			new: &model.Manifest{
+				Id:          "com.example.test",
+				Name:        "Example",
+				Version:     "0.2.0",
+				Description: "Posts a|b|c",
+				SettingsSchema: &model.PluginSettingsSchema{Settings: []*model.PluginSetting{
+					{Key: "Mode", DisplayName: "Mode", Type: "dropdown", Default: "fast", Options: diffTestOptions("fast", "eager")},
+					{Key: "Limit", Type: "number", Default: 25},
+					{Key: "Token", DisplayName: "Token", Type: "generated"},
+				}},
+			},
+		},
+		{
+			name: "upgrade_notes_no_changes.md",
+			old:  diffTestManifest("0.1.0"),
+			new:  diffTestManifest("0.1.0"),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			diff, err := diffManifests(test.old, test.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			notes, err := renderUpgradeNotes(diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test.name, notes)
+		})
+	}
+}
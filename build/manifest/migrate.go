@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// migration is a single change made by migrate to bring a manifest up to current conventions.
+type migration struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// migrateManifest rewrites deprecated or missing fields in the manifest, returning the changes
+// made. The manifest is only rewritten, and the generated files only reapplied, if there are any.
+//
+// Unlike bump, migrate restructures the manifest, so the file is re-encoded as convert would.
+func migrateManifest(p *project, manifest *model.Manifest, manifestPath, minServerVersion string) ([]migration, error) {
+	var migrations []migration
+
+	original, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", manifestPath)
+	}
+	declared, _, err := manifestExecutables(original, manifestFormat(manifestPath))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read executables from %s", manifestPath)
+	}
+
+	// Executables found for platforms the vendored model doesn't define can't be recorded in
+	// the manifest itself, so they are added to the rewritten file separately.
+	var extra yaml.MapSlice
+
+	if manifest.Backend != nil {
+		if manifest.Server != nil {
+			return nil, errors.New("manifest defines both backend and server, remove one of them")
+		}
+		manifest.Server = manifest.Backend
+		manifest.Backend = nil
+		migrations = append(migrations, migration{"backend", "renamed to server"})
+	}
+
+	if manifest.Server != nil && len(declared) == 0 && manifest.Server.Executable != "" {
+		executables, err := findPlatformExecutables(p, manifest.Server.Executable)
+		if err != nil {
+			return nil, err
+		}
+		if executables != nil {
+			migrations = append(migrations, migration{
+				"server.executable",
+				"replaced " + manifest.Server.Executable + " with server.executables for " + strings.Join(executablePlatforms(executables), ", "),
+			})
+			manifest.Server.Executables = &model.ManifestExecutables{
+				LinuxAmd64:   executables["linux-amd64"],
+				DarwinAmd64:  executables["darwin-amd64"],
+				WindowsAmd64: executables["windows-amd64"],
+			}
+			manifest.Server.Executable = ""
+			extra = unmodeledExecutables(executables)
+		}
+	}
+
+	if manifest.MinServerVersion == "" {
+		manifest.MinServerVersion = minServerVersion
+		migrations = append(migrations, migration{"min_server_version", "set to " + minServerVersion})
+	}
+
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+
+	data, err := reencodeManifest(manifest, manifestPath, manifestFormat(manifestPath))
+	if err != nil {
+		return nil, err
+	}
+	data, err = appendManifestExecutables(data, manifestFormat(manifestPath), extra)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(manifestPath, data, 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %s", manifestPath)
+	}
+
+	if _, err := applyManifest(p, manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to apply manifest")
+	}
+
+	return migrations, nil
+}
+
+// findPlatformExecutables looks next to the given executable for binaries named after each
+// supported platform, such as plugin-linux-amd64 and plugin-windows-amd64.exe, as built by the
+// Makefile. It returns nil unless more than one platform is found, in which case the single
+// executable is presumably a leftover.
+func findPlatformExecutables(p *project, executable string) (map[string]string, error) {
+	dir := path.Dir(filepath.ToSlash(executable))
+	files, err := ioutil.ReadDir(p.path(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", dir)
+	}
+
+	found := make(map[string]string)
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		// The platform is the last two dash separated parts of the name, such as linux-arm64 in
+		// plugin-linux-arm64, so that linux-arm isn't mistaken for it.
+		parts := strings.Split(strings.TrimSuffix(file.Name(), ".exe"), "-")
+		if len(parts) < 2 {
+			continue
+		}
+		platform, err := parsePlatform(strings.Join(parts[len(parts)-2:], "-"))
+		if err != nil {
+			continue
+		}
+		if existing, ok := found[platform.String()]; ok {
+			return nil, errors.Errorf("both %s and %s could be the %s executable", path.Base(existing), file.Name(), platform)
+		}
+		found[platform.String()] = path.Join(dir, file.Name())
+	}
+
+	if len(found) < 2 {
+		return nil, nil
+	}
+
+	return found, nil
+}
+
+// unmodeledExecutables returns the executables for platforms model.ManifestExecutables doesn't
+// define, sorted by platform.
+func unmodeledExecutables(executables map[string]string) yaml.MapSlice {
+	known := make(map[string]bool)
+	for _, platform := range modelPlatforms {
+		known[platform.String()] = true
+	}
+
+	var unmodeled yaml.MapSlice
+	for _, platform := range executablePlatforms(executables) {
+		if !known[platform] {
+			unmodeled = append(unmodeled, yaml.MapItem{Key: platform, Value: executables[platform]})
+		}
+	}
+
+	return unmodeled
+}
+
+// executablePlatforms lists the platforms with an executable, sorted.
+func executablePlatforms(executables map[string]string) []string {
+	var platforms []string
+	for platform, executable := range executables {
+		if executable != "" {
+			platforms = append(platforms, platform)
+		}
+	}
+	sort.Strings(platforms)
+
+	return platforms
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrateManifest(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		file        string
+		data        string
+		files       []string
+		migrations  []string
+		executables map[string]string
+		fallback    string
+		contains    []string
+		err         string
+	}{
+		{
+			name:     "up to date",
+			file:     "plugin.json",
+			data:     `{"id": "com.example.test", "version": "0.1.0", "min_server_version": "5.6.0", "server": {"executable": "server/dist/plugin-linux-amd64"}}`,
+			files:    []string{"server/dist/plugin-linux-amd64"},
+			fallback: "server/dist/plugin-linux-amd64",
+		},
+		{
+			name:       "backend",
+			file:       "plugin.json",
+			data:       `{"id": "com.example.test", "version": "0.1.0", "min_server_version": "5.6.0", "backend": {"executable": "server/dist/plugin-linux-amd64"}}`,
+			migrations: []string{"backend"},
+			fallback:   "server/dist/plugin-linux-amd64",
+			contains:   []string{`"server": {`},
+		},
+		{
+			name: "both backend and server",
+			file: "plugin.json",
+			data: `{"id": "com.example.test", "version": "0.1.0", "backend": {"executable": "a"}, "server": {"executable": "b"}}`,
+			err:  "manifest defines both backend and server",
+		},
+		{
+			name:       "min_server_version",
+			file:       "plugin.json",
+			data:       `{"id": "com.example.test", "version": "0.1.0"}`,
+			migrations: []string{"min_server_version"},
+			contains:   []string{`"min_server_version": "5.6.0"`},
+		},
+		{
+			name:     "single platform executable",
+			file:     "plugin.json",
+			data:     `{"id": "com.example.test", "version": "0.1.0", "min_server_version": "5.6.0", "server": {"executable": "server/dist/plugin-linux-amd64"}}`,
+			files:    []string{"server/dist/plugin-linux-amd64", "server/dist/plugin.go"},
+			fallback: "server/dist/plugin-linux-amd64",
+		},
+		{
+			name:       "executable built for several platforms",
+			file:       "plugin.json",
+			data:       `{"id": "com.example.test", "version": "0.1.0", "min_server_version": "5.6.0", "server": {"executable": "server/dist/plugin-linux-amd64"}}`,
+			files:      []string{"server/dist/plugin-linux-amd64", "server/dist/plugin-darwin-amd64", "server/dist/plugin-linux-arm64", "server/dist/plugin-windows-amd64.exe"},
+			migrations: []string{"server.executable"},
+			executables: map[string]string{
+				"linux-amd64":   "server/dist/plugin-linux-amd64",
+				"darwin-amd64":  "server/dist/plugin-darwin-amd64",
+				"linux-arm64":   "server/dist/plugin-linux-arm64",
+				"windows-amd64": "server/dist/plugin-windows-amd64.exe",
+			},
+		},
+		{
+			name:       "executable built for several platforms in yaml",
+			file:       "plugin.yaml",
+			data:       "id: com.example.test\nversion: 0.1.0\nmin_server_version: 5.6.0\nserver:\n  executable: server/dist/plugin-linux-amd64\n",
+			files:      []string{"server/dist/plugin-linux-amd64", "server/dist/plugin-linux-arm64"},
+			migrations: []string{"server.executable"},
+			executables: map[string]string{
+				"linux-amd64": "server/dist/plugin-linux-amd64",
+				"linux-arm64": "server/dist/plugin-linux-arm64",
+			},
+		},
+		{
+			name:  "ambiguous platform executables",
+			file:  "plugin.json",
+			data:  `{"id": "com.example.test", "version": "0.1.0", "server": {"executable": "server/dist/plugin-linux-amd64"}}`,
+			files: []string{"server/dist/plugin-linux-amd64", "server/dist/webex-linux-amd64", "server/dist/plugin-darwin-amd64"},
+			err:   "could be the linux-amd64 executable",
+		},
+		{
+			name:       "executables for platforms unknown to the model",
+			file:       "plugin.json",
+			data:       `{"id": "com.example.test", "version": "0.1.0", "server": {"executables": {"linux-arm64": "server/dist/plugin-linux-arm64"}, "executable": "server/dist/plugin-linux-amd64"}}`,
+			files:      []string{"server/dist/plugin-linux-amd64", "server/dist/plugin-darwin-amd64"},
+			migrations: []string{"min_server_version"},
+			executables: map[string]string{
+				"linux-arm64": "server/dist/plugin-linux-arm64",
+			},
+			fallback: "server/dist/plugin-linux-amd64",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "migrate")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			// apply writes the generated server manifest after any migration.
+			if err := os.MkdirAll(filepath.Join(dir, "server"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range test.files {
+				name = filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(name, nil, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			manifestPath := filepath.Join(dir, test.file)
+			if err := ioutil.WriteFile(manifestPath, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			p := newProject()
+			p.Root = dir
+			manifest, err := decodeManifest(strings.NewReader(test.data), manifestFormat(manifestPath), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			migrations, err := migrateManifest(p, manifest, manifestPath, "5.6.0")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var fields []string
+			for _, m := range migrations {
+				fields = append(fields, m.Field)
+			}
+			if !reflect.DeepEqual(fields, test.migrations) {
+				t.Errorf("expected migrations of %q, got %q", test.migrations, fields)
+			}
+
+			data, err := ioutil.ReadFile(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(migrations) == 0 && string(data) != test.data {
+				t.Errorf("expected an up to date manifest to be left alone, got:\n%s", data)
+			}
+			for _, expected := range test.contains {
+				if !bytes.Contains(data, []byte(expected)) {
+					t.Errorf("expected migrated manifest to contain %s, got:\n%s", expected, data)
+				}
+			}
+
+			executables, fallback, err := manifestExecutables(data, manifestFormat(manifestPath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(executables) > 0 || len(test.executables) > 0) && !reflect.DeepEqual(executables, test.executables) {
+				t.Errorf("expected executables %v, got %v", test.executables, executables)
+			}
+			if fallback != test.fallback {
+				t.Errorf("expected executable %q, got %q", test.fallback, fallback)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Exit codes distinguish classes of failure for callers such as build/setup.mk and CI.
+const (
+	// exitCheckFailed means the command ran, but found problems: validation errors, drift or an
+	// incompatible server.
+	exitCheckFailed = 1
+	// exitUsage means the command line itself was invalid.
+	exitUsage = 2
+	// exitManifest means the manifest could not be found or parsed.
+	exitManifest = 3
+	// exitFailed means the command could not complete, typically while reading or writing files.
+	exitFailed = 4
+	// exitRemote means a Mattermost server could not be reached or rejected a request.
+	exitRemote = 5
+)
+
+var exitClasses = map[int]string{
+	exitCheckFailed: "check",
+	exitUsage:       "usage",
+	exitManifest:    "manifest",
+	exitFailed:      "failed",
+	exitRemote:      "remote",
+}
+
+// exitError associates an error with the exit code reporting its class of failure.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// withExitCode wraps err so that the tool exits with the given code. A nil err stays nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &exitError{code: code, err: err}
+}
+
+// usageErrorf reports an invalid command line.
+func usageErrorf(format string, args ...interface{}) error {
+	return withExitCode(exitUsage, errors.Errorf(format, args...))
+}
+
+// exitCode returns the exit code for err, defaulting to exitFailed for unclassified errors. The
+// code is found through any context added with errors.Wrap.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := errors.Cause(err).(*exitError); ok {
+		return exitErr.code
+	}
+
+	return exitFailed
+}
+
+// reporter writes command results either as human-readable text or, with --json, as a single
+// JSON document per invocation.
+type reporter struct {
+	json   bool
+	stdout io.Writer
+	stderr io.Writer
+
+	result   interface{}
+	warnings []string
+}
+
+// jsonReport is the document written in JSON mode.
+type jsonReport struct {
+	OK       bool        `json:"ok"`
+	Result   interface{} `json:"result,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+	Error    *jsonError  `json:"error,omitempty"`
+}
+
+type jsonError struct {
+	Code    int    `json:"code"`
+	Class   string `json:"class"`
+	Message string `json:"message"`
+}
+
+// Result records the structured result of the command for JSON mode, or calls text to describe
+// it on standard out otherwise.
+func (r *reporter) Result(value interface{}, text func(w io.Writer)) {
+	if r.json {
+		r.result = value
+		return
+	}
+
+	if text != nil {
+		text(r.stdout)
+	}
+}
+
+// Warn writes a warning to standard error, or in JSON mode records it in the report.
+func (r *reporter) Warn(format string, args ...interface{}) {
+	if r.json {
+		r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+		return
+	}
+
+	fmt.Fprintf(r.stderr, "warning: "+format+"\n", args...)
+}
+
+// Finish writes out the result and any error, returning the process exit code.
+func (r *reporter) Finish(err error) int {
+	code := exitCode(err)
+
+	if r.json {
+		report := jsonReport{OK: err == nil, Result: r.result, Warnings: r.warnings}
+		if err != nil {
+			report.Error = &jsonError{Code: code, Class: exitClasses[code], Message: err.Error()}
+		}
+
+		encoder := json.NewEncoder(r.stdout)
+		encoder.SetIndent("", "    ")
+		if encodeErr := encoder.Encode(report); encodeErr != nil {
+			fmt.Fprintln(r.stderr, "error: failed to write json output: "+encodeErr.Error())
+			return exitFailed
+		}
+
+		return code
+	}
+
+	if err != nil {
+		fmt.Fprintln(r.stderr, "error: "+err.Error())
+	}
+
+	return code
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"nil", nil, 0},
+		{"unclassified", errors.New("failed"), exitFailed},
+		{"classified", withExitCode(exitRemote, errors.New("failed")), exitRemote},
+		{"wrapped", errors.Wrap(withExitCode(exitManifest, errors.New("failed")), "context"), exitManifest},
+		{"wrapped twice", errors.Wrapf(errors.Wrap(usageErrorf("bad argument"), "context"), "more context"), exitUsage},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if code := exitCode(test.err); code != test.expected {
+				t.Errorf("expected exit code %d, got %d", test.expected, code)
+			}
+		})
+	}
+}
+
+func TestUnknownCommandOutsidePlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := newProject()
+	p.Root = dir
+	r := &reporter{stdout: ioutil.Discard, stderr: ioutil.Discard}
+
+	if code := exitCode(runCommand(r, p, "nonsense", nil)); code != exitUsage {
+		t.Errorf("expected exit code %d for an unknown command, got %d", exitUsage, code)
+	}
+	if code := exitCode(runCommand(r, p, "id", nil)); code != exitManifest {
+		t.Errorf("expected exit code %d without a manifest, got %d", exitManifest, code)
+	}
+}
+
+func TestReporterWarnings(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	r := &reporter{json: true, stdout: &stdout, stderr: &stderr}
+	r.Warn("%s is not a git checkout", "plugin")
+	r.Result(map[string]string{"id": "com.example.test"}, nil)
+	if code := r.Finish(nil); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"plugin is not a git checkout"}; !reflect.DeepEqual(report.Warnings, expected) {
+		t.Errorf("expected warnings %q, got %q", expected, report.Warnings)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("expected nothing on standard error in JSON mode, got %q", stderr.String())
+	}
+
+	stdout.Reset()
+	r = &reporter{stdout: &stdout, stderr: &stderr}
+	r.Warn("%s is not a git checkout", "plugin")
+	if expected := "warning: plugin is not a git checkout\n"; stderr.String() != expected {
+		t.Errorf("expected %q on standard error, got %q", expected, stderr.String())
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// serverPlatform is a GOOS and GOARCH pair the server can be built for, named as in the keys of
+// a manifest's server.executables, such as linux-amd64.
+type serverPlatform struct {
+	goOs, goArch string
+}
+
+func (p serverPlatform) String() string {
+	return p.goOs + "-" + p.goArch
+}
+
+// defaultExecutable returns the path the Makefile's server target builds the platform to.
+func (p serverPlatform) defaultExecutable() string {
+	executable := "server/dist/plugin-" + p.String()
+	if p.goOs == "windows" {
+		executable += ".exe"
+	}
+
+	return executable
+}
+
+// modelPlatforms are the platforms model.ManifestExecutables has a field for, and the platforms
+// built by default. Servers built from this model ignore executables for any other platform,
+// though newer servers recognise them.
+var modelPlatforms = []serverPlatform{
+	{"linux", "amd64"},
+	{"darwin", "amd64"},
+	{"windows", "amd64"},
+}
+
+// platformMachines are the machine types identifying each supported GOARCH in ELF, Mach-O and
+// PE headers respectively.
+var platformMachines = map[string]struct {
+	elf   elf.Machine
+	macho macho.Cpu
+	pe    uint16
+}{
+	"amd64": {elf.EM_X86_64, macho.CpuAmd64, pe.IMAGE_FILE_MACHINE_AMD64},
+	"arm64": {elf.EM_AARCH64, macho.CpuArm64, pe.IMAGE_FILE_MACHINE_ARM64},
+	"386":   {elf.EM_386, macho.Cpu386, pe.IMAGE_FILE_MACHINE_I386},
+	"arm":   {elf.EM_ARM, macho.CpuArm, pe.IMAGE_FILE_MACHINE_ARMNT},
+}
+
+// parsePlatform parses a platform such as linux-arm64. Only the operating systems the
+// Mattermost server runs on, and architectures whose executable headers can be verified, are
+// accepted.
+func parsePlatform(name string) (serverPlatform, error) {
+	parts := strings.Split(name, "-")
+	if len(parts) != 2 {
+		return serverPlatform{}, errors.Errorf("invalid platform %q, expected GOOS-GOARCH", name)
+	}
+
+	platform := serverPlatform{parts[0], parts[1]}
+	switch platform.goOs {
+	case "linux", "darwin", "windows":
+	default:
+		return serverPlatform{}, errors.Errorf("unsupported operating system %s in platform %s", platform.goOs, name)
+	}
+	if _, ok := platformMachines[platform.goArch]; !ok {
+		return serverPlatform{}, errors.Errorf("unsupported architecture %s in platform %s", platform.goArch, name)
+	}
+
+	return platform, nil
+}
+
+// parsePlatforms parses a comma or space separated list of platforms.
+func parsePlatforms(value string) ([]serverPlatform, error) {
+	var platforms []serverPlatform
+	seen := make(map[serverPlatform]bool)
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		platform, err := parsePlatform(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[platform] {
+			seen[platform] = true
+			platforms = append(platforms, platform)
+		}
+	}
+	if len(platforms) == 0 {
+		return nil, errors.New("no platforms specified")
+	}
+
+	return platforms, nil
+}
+
+// platformsFlag exposes a list of platforms as a command line flag.
+type platformsFlag struct {
+	platforms *[]serverPlatform
+}
+
+func (f platformsFlag) String() string {
+	if f.platforms == nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(*f.platforms))
+	for _, platform := range *f.platforms {
+		names = append(names, platform.String())
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (f platformsFlag) Set(value string) error {
+	platforms, err := parsePlatforms(value)
+	if err != nil {
+		return err
+	}
+	*f.platforms = platforms
+
+	return nil
+}
+
+// manifestExecutables returns the per-platform executables and the fallback executable declared
+// by the manifest encoded in the given format. Unlike model.ManifestExecutables, this includes
+// platforms unknown to the vendored model.
+func manifestExecutables(data []byte, format string) (map[string]string, string, error) {
+	document, err := parseManifestDocument(data, format)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to parse manifest")
+	}
+
+	server, _ := manifestServerSection(document)
+	if server == nil {
+		return nil, "", nil
+	}
+
+	var fallback string
+	if value, index := mapSliceGet(server, "executable"); index >= 0 && value != nil {
+		fallback = fmt.Sprint(value)
+	}
+
+	executables := make(map[string]string)
+	if value, index := mapSliceGet(server, "executables"); index >= 0 {
+		entries, _ := value.(yaml.MapSlice)
+		for _, entry := range entries {
+			if entry.Value != nil && fmt.Sprint(entry.Value) != "" {
+				executables[fmt.Sprint(entry.Key)] = fmt.Sprint(entry.Value)
+			}
+		}
+	}
+
+	return executables, fallback, nil
+}
+
+// stripPlatformExecutables removes executables for supported platforms that
+// model.ManifestExecutables doesn't define, so that the manifest can still be decoded strictly.
+// If any are removed, the result is re-encoded in the same format.
+func stripPlatformExecutables(data []byte, format string) ([]byte, error) {
+	document, err := parseManifestDocument(data, format)
+	if err != nil {
+		// Leave it to the decoder to report the problem.
+		return data, nil
+	}
+
+	if len(splitPlatformExecutables(document)) == 0 {
+		return data, nil
+	}
+
+	switch format {
+	case "json":
+		var buf bytes.Buffer
+		if err := writeOrderedJSON(&buf, document); err != nil {
+			return nil, errors.Wrap(err, "failed to encode manifest")
+		}
+		return buf.Bytes(), nil
+
+	case "yaml":
+		data, err := yaml.Marshal(document)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode manifest")
+		}
+		return data, nil
+
+	default:
+		return nil, errors.Errorf("unsupported manifest format %s", format)
+	}
+}
+
+// restorePlatformExecutables adds the executables stripPlatformExecutables removes from original
+// back to data, an encoding of the manifest decoded from it, so that they survive a rewrite.
+func restorePlatformExecutables(data []byte, format string, original []byte, originalFormat string) ([]byte, error) {
+	document, err := parseManifestDocument(original, originalFormat)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse manifest")
+	}
+
+	return appendManifestExecutables(data, format, splitPlatformExecutables(document))
+}
+
+// splitPlatformExecutables removes the executables for supported platforms that
+// model.ManifestExecutables doesn't define from the parsed manifest, and returns them.
+func splitPlatformExecutables(document yaml.MapSlice) yaml.MapSlice {
+	known := make(map[string]bool)
+	for _, platform := range modelPlatforms {
+		known[platform.String()] = true
+	}
+
+	var stripped yaml.MapSlice
+	for _, section := range []string{"server", "backend"} {
+		value, _ := mapSliceGet(document, section)
+		server, _ := value.(yaml.MapSlice)
+		value, index := mapSliceGet(server, "executables")
+		executables, ok := value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+
+		kept := yaml.MapSlice{}
+		for _, entry := range executables {
+			if _, err := parsePlatform(fmt.Sprint(entry.Key)); err == nil && !known[fmt.Sprint(entry.Key)] {
+				stripped = append(stripped, entry)
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		server[index].Value = kept
+	}
+
+	return stripped
+}
+
+// setManifestExecutables rewrites server.executables in the encoded manifest to name the default
+// executable for each platform, returning the manifest unchanged if it already does. The key
+// order of the rest of the manifest is preserved.
+func setManifestExecutables(data []byte, format string, platforms []serverPlatform) ([]byte, error) {
+	existing, _, err := manifestExecutables(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	desired := make(map[string]string)
+	executables := yaml.MapSlice{}
+	for _, platform := range platforms {
+		desired[platform.String()] = platform.defaultExecutable()
+		executables = append(executables, yaml.MapItem{Key: platform.String(), Value: platform.defaultExecutable()})
+	}
+	if reflect.DeepEqual(existing, desired) {
+		return data, nil
+	}
+
+	return writeManifestExecutables(data, format, executables)
+}
+
+// appendManifestExecutables adds the given executables to any already in server.executables in
+// the encoded manifest.
+func appendManifestExecutables(data []byte, format string, executables yaml.MapSlice) ([]byte, error) {
+	if len(executables) == 0 {
+		return data, nil
+	}
+
+	document, err := parseManifestDocument(data, format)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse manifest")
+	}
+	server, _ := manifestServerSection(document)
+	value, _ := mapSliceGet(server, "executables")
+	existing, _ := value.(yaml.MapSlice)
+
+	return writeManifestExecutables(data, format, append(append(yaml.MapSlice{}, existing...), executables...))
+}
+
+// writeManifestExecutables replaces server.executables in the encoded manifest, preserving the
+// key order of the rest of the manifest. JSON manifests keep the indentation they are written
+// with.
+func writeManifestExecutables(data []byte, format string, executables yaml.MapSlice) ([]byte, error) {
+	document, err := parseManifestDocument(data, format)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse manifest")
+	}
+
+	server, index := manifestServerSection(document)
+	if server == nil {
+		return data, nil
+	}
+	_, executablesIndex := mapSliceGet(server, "executables")
+
+	// Where possible, only the executables are replaced, leaving the formatting of the rest of
+	// the manifest as written.
+	if format == "json" && executablesIndex >= 0 {
+		start, end, err := jsonValueSpan(data, fmt.Sprint(document[index].Key), "executables")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse manifest")
+		}
+
+		lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+		indent := data[lineStart : lineStart+len(data[lineStart:start])-len(bytes.TrimLeft(data[lineStart:start], " \t"))]
+
+		var compact, indented bytes.Buffer
+		if err := writeOrderedJSON(&compact, executables); err != nil {
+			return nil, errors.Wrap(err, "failed to encode executables")
+		}
+		if err := json.Indent(&indented, compact.Bytes(), string(indent), jsonIndentUnit(data)); err != nil {
+			return nil, errors.Wrap(err, "failed to encode executables")
+		}
+
+		return append(append(append([]byte{}, data[:start]...), indented.Bytes()...), data[end:]...), nil
+	}
+
+	if executablesIndex >= 0 {
+		server[executablesIndex].Value = executables
+	} else {
+		server = append(yaml.MapSlice{{Key: "executables", Value: executables}}, server...)
+	}
+	document[index].Value = server
+
+	switch format {
+	case "json":
+		var compact bytes.Buffer
+		if err := writeOrderedJSON(&compact, document); err != nil {
+			return nil, errors.Wrap(err, "failed to encode manifest")
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, compact.Bytes(), "", jsonIndentUnit(data)); err != nil {
+			return nil, errors.Wrap(err, "failed to encode manifest")
+		}
+		return append(indented.Bytes(), '\n'), nil
+
+	case "yaml":
+		return yaml.Marshal(document)
+
+	default:
+		return nil, errors.Errorf("unsupported manifest format %s", format)
+	}
+}
+
+// jsonIndentUnit returns the indentation of the first indented line of the JSON document, which
+// is the unit it is indented by, or four spaces if no line is indented.
+func jsonIndentUnit(data []byte) string {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if trimmed := bytes.TrimLeft(line, " \t"); len(trimmed) > 0 && len(trimmed) < len(line) {
+			return string(line[:len(line)-len(trimmed)])
+		}
+	}
+
+	return "    "
+}
+
+// jsonValueSpan returns the byte offsets of the value at the given path of object keys in the
+// JSON document.
+func jsonValueSpan(data []byte, path ...string) (int, int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	for depth := 0; depth < len(path); depth++ {
+		if token, err := decoder.Token(); err != nil {
+			return 0, 0, err
+		} else if token != json.Delim('{') {
+			return 0, 0, errors.Errorf("%s is not an object", strings.Join(path[:depth], "."))
+		}
+
+		for {
+			if !decoder.More() {
+				return 0, 0, errors.Errorf("%s not found", strings.Join(path[:depth+1], "."))
+			}
+
+			token, err := decoder.Token()
+			if err != nil {
+				return 0, 0, err
+			}
+			if token == path[depth] {
+				break
+			}
+
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	// The decoder is positioned just after the last key: skip the colon and any whitespace.
+	start := int(decoder.InputOffset())
+	start += bytes.IndexByte(data[start:], ':') + 1
+	start += len(data[start:]) - len(bytes.TrimLeft(data[start:], " \t\r\n"))
+
+	var value json.RawMessage
+	if err := decoder.Decode(&value); err != nil {
+		return 0, 0, err
+	}
+
+	return start, int(decoder.InputOffset()), nil
+}
+
+// manifestServerSection returns the server section of the manifest, or the deprecated backend
+// section in its absence, along with its index in the document.
+func manifestServerSection(document yaml.MapSlice) (yaml.MapSlice, int) {
+	for _, section := range []string{"server", "backend"} {
+		if value, index := mapSliceGet(document, section); index >= 0 {
+			if server, ok := value.(yaml.MapSlice); ok {
+				return server, index
+			}
+		}
+	}
+
+	return nil, -1
+}
+
+// mapSliceGet returns the value of key and its index, or -1 if it's absent.
+func mapSliceGet(m yaml.MapSlice, key string) (interface{}, int) {
+	for i, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value, i
+		}
+	}
+
+	return nil, -1
+}
+
+// writeOrderedJSON encodes a document decoded into a yaml.MapSlice as compact JSON, preserving
+// its key order.
+func writeOrderedJSON(buf *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		buf.WriteByte('{')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeOrderedJSON(buf, fmt.Sprint(item.Key)); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeOrderedJSON(buf, item.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeOrderedJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	default:
+		// Leave HTML in help text and the like as written.
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+
+	return nil
+}
+
+// verifyExecutable checks that the executable's ELF, Mach-O or PE header matches its platform.
+func verifyExecutable(executablePath string, platform serverPlatform) error {
+	machines := platformMachines[platform.goArch]
+
+	switch platform.goOs {
+	case "linux":
+		file, err := elf.Open(executablePath)
+		if err != nil {
+			return errors.Errorf("%s is not an ELF executable for %s", executablePath, platform)
+		}
+		defer file.Close()
+		if file.Machine != machines.elf {
+			return errors.Errorf("%s is built for %s, not %s", executablePath, file.Machine, platform)
+		}
+
+	case "darwin":
+		file, err := macho.Open(executablePath)
+		if err != nil {
+			return errors.Errorf("%s is not a Mach-O executable for %s", executablePath, platform)
+		}
+		defer file.Close()
+		if file.Cpu != machines.macho {
+			return errors.Errorf("%s is built for %s, not %s", executablePath, file.Cpu, platform)
+		}
+
+	case "windows":
+		file, err := pe.Open(executablePath)
+		if err != nil {
+			return errors.Errorf("%s is not a PE executable for %s", executablePath, platform)
+		}
+		defer file.Close()
+		if file.Machine != machines.pe {
+			return errors.Errorf("%s is built for machine %#x, not %s", executablePath, file.Machine, platform)
+		}
+	}
+
+	return nil
+}
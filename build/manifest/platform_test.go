@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlatformExecutablesSurviveReencoding(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		format   string
+		original string
+		encoded  string
+		expected string
+	}{
+		{
+			name:     "json",
+			format:   "json",
+			original: `{"id": "com.example.test", "server": {"executables": {"linux-amd64": "a", "linux-arm64": "b"}}}`,
+			encoded:  "{\n    \"id\": \"com.example.test\",\n    \"server\": {\n        \"executables\": {\n            \"linux-amd64\": \"a\"\n        }\n    }\n}\n",
+			expected: "{\n    \"id\": \"com.example.test\",\n    \"server\": {\n        \"executables\": {\n            \"linux-amd64\": \"a\",\n            \"linux-arm64\": \"b\"\n        }\n    }\n}\n",
+		},
+		{
+			name:     "json to yaml from backend",
+			format:   "yaml",
+			original: `{"id": "com.example.test", "backend": {"executables": {"linux-arm64": "b"}}}`,
+			encoded:  "id: com.example.test\nserver:\n  executable: a\n",
+			expected: "id: com.example.test\nserver:\n  executables:\n    linux-arm64: b\n  executable: a\n",
+		},
+		{
+			name:     "nothing stripped",
+			format:   "json",
+			original: `{"id": "com.example.test", "server": {"executables": {"linux-amd64": "a"}}}`,
+			encoded:  `{"id": "com.example.test"}`,
+			expected: `{"id": "com.example.test"}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stripped, err := stripPlatformExecutables([]byte(test.original), "json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(stripped, []byte("linux-arm64")) {
+				t.Errorf("expected linux-arm64 to be stripped, got %s", stripped)
+			}
+			if _, err := decodeManifest(bytes.NewReader(stripped), "json", true); err != nil {
+				t.Errorf("failed to decode stripped manifest as json: %v", err)
+			}
+
+			data, err := restorePlatformExecutables([]byte(test.encoded), test.format, []byte(test.original), "json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, data)
+			}
+		})
+	}
+}
+
+func TestManifestExecutables(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		format      string
+		data        string
+		executables map[string]string
+		fallback    string
+	}{
+		{
+			name:        "json with escaped slashes",
+			format:      "json",
+			data:        `{"id": "com.example.test", "server": {"executables": {"linux-arm64": "server\/dist\/plugin-linux-arm64"}, "executable": "server\/dist\/plugin-linux-amd64"}}`,
+			executables: map[string]string{"linux-arm64": "server/dist/plugin-linux-arm64"},
+			fallback:    "server/dist/plugin-linux-amd64",
+		},
+		{
+			name:        "yaml backend",
+			format:      "yaml",
+			data:        "id: com.example.test\nbackend:\n  executables:\n    darwin-arm64: server/dist/plugin-darwin-arm64\n",
+			executables: map[string]string{"darwin-arm64": "server/dist/plugin-darwin-arm64"},
+		},
+		{
+			name:   "no server",
+			format: "json",
+			data:   `{"id": "com.example.test"}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			executables, fallback, err := manifestExecutables([]byte(test.data), test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(executables) > 0 || len(test.executables) > 0) && !reflect.DeepEqual(executables, test.executables) {
+				t.Errorf("expected executables %v, got %v", test.executables, executables)
+			}
+			if fallback != test.fallback {
+				t.Errorf("expected executable %q, got %q", test.fallback, fallback)
+			}
+		})
+	}
+}
+
+func TestSetManifestExecutables(t *testing.T) {
+	platforms := []serverPlatform{{"linux", "amd64"}, {"linux", "arm64"}}
+
+	for _, test := range []struct {
+		name     string
+		format   string
+		data     string
+		expected string
+	}{
+		{
+			name:     "json with escaped slashes",
+			format:   "json",
+			data:     "{\n    \"id\": \"com.example.test\",\n    \"description\": \"Reads and\\/or writes\",\n    \"server\": {\n        \"executables\": {\n            \"linux-amd64\": \"server\\/dist\\/plugin-linux-amd64\"\n        }\n    }\n}\n",
+			expected: "{\n    \"id\": \"com.example.test\",\n    \"description\": \"Reads and\\/or writes\",\n    \"server\": {\n        \"executables\": {\n            \"linux-amd64\": \"server/dist/plugin-linux-amd64\",\n            \"linux-arm64\": \"server/dist/plugin-linux-arm64\"\n        }\n    }\n}\n",
+		},
+		{
+			name:     "json indented with tabs",
+			format:   "json",
+			data:     "{\n\t\"id\": \"com.example.test\",\n\t\"server\": {\n\t\t\"executables\": {\n\t\t\t\"darwin-amd64\": \"server/dist/plugin-darwin-amd64\"\n\t\t}\n\t}\n}\n",
+			expected: "{\n\t\"id\": \"com.example.test\",\n\t\"server\": {\n\t\t\"executables\": {\n\t\t\t\"linux-amd64\": \"server/dist/plugin-linux-amd64\",\n\t\t\t\"linux-arm64\": \"server/dist/plugin-linux-arm64\"\n\t\t}\n\t}\n}\n",
+		},
+		{
+			name:     "json indented with tabs without executables",
+			format:   "json",
+			data:     "{\n\t\"id\": \"com.example.test\",\n\t\"server\": {\n\t\t\"executable\": \"server/dist/plugin-linux-amd64\"\n\t}\n}\n",
+			expected: "{\n\t\"id\": \"com.example.test\",\n\t\"server\": {\n\t\t\"executables\": {\n\t\t\t\"linux-amd64\": \"server/dist/plugin-linux-amd64\",\n\t\t\t\"linux-arm64\": \"server/dist/plugin-linux-arm64\"\n\t\t},\n\t\t\"executable\": \"server/dist/plugin-linux-amd64\"\n\t}\n}\n",
+		},
+		{
+			name:     "json already up to date",
+			format:   "json",
+			data:     "{\"server\": {\"executables\": {\"linux-arm64\": \"server\\/dist\\/plugin-linux-arm64\", \"linux-amd64\": \"server/dist/plugin-linux-amd64\"}}}",
+			expected: "{\"server\": {\"executables\": {\"linux-arm64\": \"server\\/dist\\/plugin-linux-arm64\", \"linux-amd64\": \"server/dist/plugin-linux-amd64\"}}}",
+		},
+		{
+			name:     "yaml",
+			format:   "yaml",
+			data:     "id: com.example.test\nserver:\n  executable: server/dist/plugin-linux-amd64\n",
+			expected: "id: com.example.test\nserver:\n  executables:\n    linux-amd64: server/dist/plugin-linux-amd64\n    linux-arm64: server/dist/plugin-linux-arm64\n  executable: server/dist/plugin-linux-amd64\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := setManifestExecutables([]byte(test.data), test.format, platforms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, data)
+			}
+		})
+	}
+}
+
+func TestApplyWithPlatformsLeavesManifestAlone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const manifestData = "{\n    \"id\": \"com.example.test\",\n    \"version\": \"0.1.0\",\n    \"description\": \"Reads and\\/or writes\",\n    \"server\": {\n        \"executable\": \"server/dist/plugin-linux-amd64\"\n    }\n}\n"
+	manifestPath := filepath.Join(dir, "plugin.json")
+	if err := ioutil.WriteFile(manifestPath, []byte(manifestData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "server"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newProject()
+	p.Root = dir
+	p.Platforms = []serverPlatform{{"linux", "amd64"}, {"linux", "arm64"}}
+	manifest, err := decodeManifest(strings.NewReader(manifestData), "json", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := applyManifest(p, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != manifestData {
+		t.Errorf("expected apply to leave the manifest alone, got:\n%s", data)
+	}
+
+	serverManifest, err := ioutil.ReadFile(filepath.Join(dir, "server", "manifest.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(serverManifest, []byte(`"linux-amd64": "server/dist/plugin-linux-amd64"`)) {
+		t.Errorf("expected the server manifest to name the linux-amd64 executable, got:\n%s", serverManifest)
+	}
+
+	bundled, err := bundledManifest(p, manifest, manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executables, _, err := manifestExecutables(bundled, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"linux-amd64": "server/dist/plugin-linux-amd64", "linux-arm64": "server/dist/plugin-linux-arm64"}
+	if !reflect.DeepEqual(executables, expected) {
+		t.Errorf("expected the bundled manifest to name executables %v, got %v", expected, executables)
+	}
+}
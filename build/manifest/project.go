@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// project locates a plugin's manifest and the files generated from it, so that a single build
+// of the tool can serve any plugin directory.
+type project struct {
+	// Root is the plugin's root directory. Relative paths below are resolved against it.
+	Root string
+
+	// ManifestPath is the manifest to use, resolved against the working directory. If empty,
+	// plugin.yml, plugin.yaml or plugin.json is looked up in Root.
+	ManifestPath string
+
+	// ServerManifestPath is where apply writes the server's copy of the manifest.
+	ServerManifestPath string
+
+	// ServerConfigurationPath is where apply writes the server's configuration struct.
+	ServerConfigurationPath string
+
+	// WebappManifestPath is where apply writes the webapp's copy of the manifest.
+	WebappManifestPath string
+
+	// Platforms is the matrix the server is built for. If set, the bundled copy of the manifest
+	// names an executable for each of them, replacing any others.
+	Platforms []serverPlatform
+
+	// GitVersion derives the plugin version from git describe rather than the manifest, which
+	// is left untouched. See describeVersion.
+	GitVersion bool
+}
+
+func newProject() *project {
+	return &project{
+		Root:                    ".",
+		ServerManifestPath:      "server/manifest.go",
+		ServerConfigurationPath: "server/configuration_gen.go",
+		WebappManifestPath:      "webapp/src/manifest.js",
+	}
+}
+
+// registerFlags exposes the project's paths as command line flags.
+func (p *project) registerFlags(flags *flag.FlagSet) {
+	flags.StringVar(&p.Root, "root", p.Root, "plugin root directory")
+	flags.StringVar(&p.ManifestPath, "manifest", p.ManifestPath, "manifest file, looked up in the root directory by default")
+	flags.StringVar(&p.ServerManifestPath, "server-manifest", p.ServerManifestPath, "generated server manifest, relative to the root directory")
+	flags.StringVar(&p.ServerConfigurationPath, "server-configuration", p.ServerConfigurationPath, "generated server configuration, relative to the root directory")
+	flags.StringVar(&p.WebappManifestPath, "webapp-manifest", p.WebappManifestPath, "generated webapp manifest, relative to the root directory")
+	flags.Var(platformsFlag{&p.Platforms}, "platforms", "server platforms to build, such as linux-amd64,linux-arm64")
+	flags.BoolVar(&p.GitVersion, "git-version", p.GitVersion, "derive the plugin version from git tags instead of the manifest")
+}
+
+// path resolves name against the plugin root, unless it is already absolute.
+func (p *project) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(p.Root, filepath.FromSlash(name))
+}
+
+// findManifestPath returns the path of the manifest to use.
+func (p *project) findManifestPath() (string, error) {
+	if p.ManifestPath != "" {
+		return p.ManifestPath, nil
+	}
+
+	_, manifestPath, err := model.FindManifest(p.Root)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to find manifest in %s", p.Root)
+	}
+
+	return manifestPath, nil
+}
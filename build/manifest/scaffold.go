@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+const scaffoldMainGoFile = `package main
+
+import (
+	"github.com/mattermost/mattermost-server/plugin"
+)
+
+func main() {
+	plugin.ClientMain(&Plugin{})
+}
+`
+
+const scaffoldPluginGoFile = `package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/plugin"
+)
+
+// Plugin implements the interface expected by the Mattermost server to communicate between the
+// server and plugin processes.
+type Plugin struct {
+	plugin.MattermostPlugin
+
+	// configurationLock synchronizes access to the configuration.
+	configurationLock sync.RWMutex
+
+	// configuration is the active plugin configuration. Consult getConfiguration and
+	// setConfiguration for usage.
+	configuration *configuration
+}
+
+// OnActivate is invoked when the plugin is activated.
+func (p *Plugin) OnActivate() error {
+	if err := p.getConfiguration().IsValid(); err != nil {
+		return err
+	}
+
+	return p.registerCommands()
+}
+
+// ServeHTTP routes requests to /plugins/{id}/... to the plugin's handlers.
+func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/status":
+		p.handleStatus(w, r)
+	case "/about":
+		p.handleAbout(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleStatus reports the plugin's id and version.
+func (p *Plugin) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":      manifest.Id,
+		"version": manifest.Version,
+	})
+}
+`
+
+const scaffoldConfigurationGoFile = `package main
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// getConfiguration retrieves the active configuration under lock, making it safe to use
+// concurrently. The active configuration may change underneath the client of this method, but
+// the struct returned by this API call is considered immutable.
+func (p *Plugin) getConfiguration() *configuration {
+	p.configurationLock.RLock()
+	defer p.configurationLock.RUnlock()
+
+	if p.configuration == nil {
+		config := &configuration{}
+		config.SetDefaults()
+		return config
+	}
+
+	return p.configuration
+}
+
+// setConfiguration replaces the active configuration under lock.
+//
+// Do not call setConfiguration while holding the configurationLock, as sync.Mutex is not
+// reentrant. In particular, avoid using the plugin API entirely, as this may in turn trigger a
+// hook back into the plugin. If that hook attempts to acquire this lock, a deadlock may occur.
+func (p *Plugin) setConfiguration(configuration *configuration) {
+	p.configurationLock.Lock()
+	defer p.configurationLock.Unlock()
+
+	if configuration != nil && p.configuration == configuration {
+		// Ignore assignment if the configuration struct is empty. Go will optimize the
+		// allocation for same to point at the same memory address, breaking the check above.
+		if reflect.ValueOf(*configuration).NumField() == 0 {
+			return
+		}
+
+		panic("setConfiguration called with the existing configuration")
+	}
+
+	p.configuration = configuration
+}
+
+// OnConfigurationChange is invoked when configuration changes may have been made.
+func (p *Plugin) OnConfigurationChange() error {
+	var configuration = new(configuration)
+	configuration.SetDefaults()
+
+	// Load the public configuration fields from the Mattermost server configuration.
+	if err := p.API.LoadPluginConfiguration(configuration); err != nil {
+		return errors.Wrap(err, "failed to load plugin configuration")
+	}
+
+	if err := configuration.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid plugin configuration")
+	}
+
+	p.setConfiguration(configuration)
+
+	return nil
+}
+`
+
+const scaffoldAboutGoFile = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+// buildInfo identifies the running build of the plugin, so that a bug report can be traced back
+// to the commit it was built from.
+type buildInfo struct {
+	Id        string ` + "`" + `json:"id"` + "`" + `
+	Version   string ` + "`" + `json:"version"` + "`" + `
+	Commit    string ` + "`" + `json:"commit"` + "`" + `
+	Dirty     bool   ` + "`" + `json:"dirty"` + "`" + `
+	BuildTime string ` + "`" + `json:"build_time"` + "`" + `
+	GoVersion string ` + "`" + `json:"go_version"` + "`" + `
+}
+
+// getBuildInfo combines the manifest with the build metadata stamped by the linker.
+func getBuildInfo() buildInfo {
+	return buildInfo{
+		Id:        manifest.Id,
+		Version:   manifest.Version,
+		Commit:    buildCommit,
+		Dirty:     buildDirty == "true",
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+}
+
+func (b buildInfo) String() string {
+	commit := b.Commit
+	if commit == "" {
+		commit = "unknown"
+	} else if b.Dirty {
+		commit += " (dirty)"
+	}
+
+	buildTime := b.BuildTime
+	if buildTime == "" {
+		buildTime = "unknown"
+	}
+
+	return fmt.Sprintf("%s %s\ncommit: %s\nbuilt: %s with %s", b.Id, b.Version, commit, buildTime, b.GoVersion)
+}
+
+// handleAbout reports the plugin's build information.
+func (p *Plugin) handleAbout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(getBuildInfo())
+}
+`
+
+// scaffoldCommandGoFile is formatted with the trigger of the plugin's slash command.
+const scaffoldCommandGoFile = `package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/pkg/errors"
+)
+
+const commandTrigger = %q
+
+// registerCommands registers the plugin's slash command with the server.
+func (p *Plugin) registerCommands() error {
+	err := p.API.RegisterCommand(&model.Command{
+		Trigger:          commandTrigger,
+		AutoComplete:     true,
+		AutoCompleteDesc: "Available commands: about",
+		AutoCompleteHint: "[command]",
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to register /%%s command", commandTrigger)
+	}
+
+	return nil
+}
+
+// ExecuteCommand runs the plugin's slash command.
+func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	fields := strings.Fields(args.Command)
+	if len(fields) < 2 {
+		return ephemeralResponse("Usage: /" + commandTrigger + " about"), nil
+	}
+
+	switch fields[1] {
+	case "about":
+		return ephemeralResponse(getBuildInfo().String()), nil
+	default:
+		return ephemeralResponse("Unknown command: " + fields[1]), nil
+	}
+}
+
+func ephemeralResponse(text string) *model.CommandResponse {
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         text,
+	}
+}
+`
+
+const scaffoldPluginTestGoFile = `package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeHTTP(t *testing.T) {
+	for _, test := range []struct {
+		method       string
+		path         string
+		expectedCode int
+	}{
+		{http.MethodGet, "/status", http.StatusOK},
+		{http.MethodPost, "/status", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/about", http.StatusOK},
+		{http.MethodGet, "/unknown", http.StatusNotFound},
+	} {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			p := &Plugin{}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, test.path, nil)
+
+			p.ServeHTTP(nil, w, r)
+
+			result := w.Result()
+			if result.StatusCode != test.expectedCode {
+				t.Fatalf("expected status %d, got %d", test.expectedCode, result.StatusCode)
+			}
+
+			if test.expectedCode == http.StatusOK {
+				body, err := ioutil.ReadAll(result.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(body), manifest.Id) {
+					t.Fatalf("expected body to contain %s, got %s", manifest.Id, body)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultConfigurationIsValid(t *testing.T) {
+	p := &Plugin{}
+
+	if err := p.getConfiguration().IsValid(); err != nil {
+		t.Fatalf("expected default configuration to be valid, got %s", err.Error())
+	}
+}
+`
+
+const scaffoldGopkgTomlFile = `[prune]
+  go-tests = true
+  unused-packages = true
+
+[[constraint]]
+  name = "github.com/mattermost/mattermost-server"
+  version = "~5.6.0"
+
+[[constraint]]
+  name = "github.com/pkg/errors"
+  version = "0.8.0"
+`
+
+const scaffoldGitignoreFile = `.depensure
+coverage.txt
+dist
+vendor
+`
+
+// scaffoldResult lists the server files scaffold created, those it left alone because they
+// already existed, and those it generated from the manifest.
+type scaffoldResult struct {
+	Created   []string `json:"created"`
+	Skipped   []string `json:"skipped"`
+	Generated []string `json:"generated"`
+}
+
+// scaffoldServer creates the server plugin package next to the generated server manifest,
+// without overwriting any existing files, and then generates the server's copy of the manifest
+// and its configuration so that the package builds immediately.
+func scaffoldServer(p *project, manifest *model.Manifest) (*scaffoldResult, error) {
+	if !manifest.HasServer() {
+		return nil, errors.New("manifest does not define a server")
+	}
+
+	serverDir := filepath.Dir(p.path(p.ServerManifestPath))
+	if err := os.MkdirAll(serverDir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", serverDir)
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"main.go", scaffoldMainGoFile},
+		{"plugin.go", scaffoldPluginGoFile},
+		{"configuration.go", scaffoldConfigurationGoFile},
+		{"about.go", scaffoldAboutGoFile},
+		{"command.go", fmt.Sprintf(scaffoldCommandGoFile, commandTrigger(manifest.Id))},
+		{"plugin_test.go", scaffoldPluginTestGoFile},
+		{"Gopkg.toml", scaffoldGopkgTomlFile},
+		{".gitignore", scaffoldGitignoreFile},
+	}
+
+	result := &scaffoldResult{}
+	for _, file := range files {
+		filePath := filepath.Join(serverDir, file.name)
+		if _, err := os.Stat(filePath); err == nil {
+			result.Skipped = append(result.Skipped, filePath)
+			continue
+		} else if !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to stat %s", filePath)
+		}
+
+		if err := ioutil.WriteFile(filePath, []byte(file.content), 0644); err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s", filePath)
+		}
+		result.Created = append(result.Created, filePath)
+	}
+
+	generated, err := renderGeneratedFiles(p, manifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range generated {
+		if filepath.Dir(file.Path) != serverDir {
+			continue
+		}
+		if err := ioutil.WriteFile(file.Path, file.Content, 0644); err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s", file.Path)
+		}
+		result.Generated = append(result.Generated, file.Path)
+	}
+
+	return result, nil
+}
+
+// commandTrigger derives the slash command trigger from the last component of the plugin id,
+// such that com.github.stevepartridge.webex registers /webex.
+func commandTrigger(pluginId string) string {
+	return strings.ToLower(pluginId[strings.LastIndex(pluginId, ".")+1:])
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+func TestScaffoldServerKeepsExistingFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaffold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifestData := `{"id": "com.example.test", "version": "0.1.0", "server": {"executable": "server/dist/plugin-linux-amd64"}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "plugin.json"), []byte(manifestData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	serverDir := filepath.Join(dir, "server")
+	if err := os.MkdirAll(serverDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const existing = "package main\n\n// Plugin is already written.\ntype Plugin struct{}\n"
+	if err := ioutil.WriteFile(filepath.Join(serverDir, "plugin.go"), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newProject()
+	p.Root = dir
+	manifest := &model.Manifest{Id: "com.example.test", Version: "0.1.0", Server: &model.ManifestServer{Executable: "server/dist/plugin-linux-amd64"}}
+
+	result, err := scaffoldServer(p, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join(serverDir, "plugin.go")}; !reflect.DeepEqual(result.Skipped, expected) {
+		t.Errorf("expected skipped %q, got %q", expected, result.Skipped)
+	}
+	if len(result.Created) != 7 {
+		t.Errorf("expected the other 7 files to be created, got %q", result.Created)
+	}
+	if expected := []string{filepath.Join(serverDir, "manifest.go"), filepath.Join(serverDir, "configuration_gen.go")}; !reflect.DeepEqual(result.Generated, expected) {
+		t.Errorf("expected generated %q, got %q", expected, result.Generated)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(serverDir, "plugin.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != existing {
+		t.Errorf("expected plugin.go to be left alone, got:\n%s", data)
+	}
+
+	// Scaffolding again leaves everything written the first time in place.
+	if err := ioutil.WriteFile(filepath.Join(serverDir, "main.go"), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = scaffoldServer(p, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Created) != 0 {
+		t.Errorf("expected nothing to be created, got %q", result.Created)
+	}
+	if len(result.Skipped) != 8 {
+		t.Errorf("expected all 8 files to be skipped, got %q", result.Skipped)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(serverDir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != existing {
+		t.Errorf("expected main.go to be left alone, got:\n%s", data)
+	}
+}
+
+func TestScaffoldServerWithoutServer(t *testing.T) {
+	p := newProject()
+	if _, err := scaffoldServer(p, &model.Manifest{Id: "com.example.test"}); err == nil {
+		t.Error("expected an error for a manifest without a server")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// signedStatement is the content covered by a bundle signature. Besides the digest of the
+// bundle itself, it pins the manifest inside the bundle so that verify can report a mismatch
+// between the two directly.
+type signedStatement struct {
+	Bundle         string `json:"bundle"`
+	BundleSHA256   string `json:"bundle_sha256"`
+	PluginId       string `json:"plugin_id"`
+	Version        string `json:"version"`
+	ManifestSHA256 string `json:"manifest_sha256"`
+}
+
+// bundleSignature is the detached signature written next to the bundle. The signature covers
+// the compact JSON encoding of Statement, which is indented in the file for readability.
+type bundleSignature struct {
+	Algorithm string          `json:"algorithm"`
+	Statement json.RawMessage `json:"statement"`
+	Signature []byte          `json:"signature"`
+}
+
+// signatureAlgorithm is the only signature scheme supported.
+const signatureAlgorithm = "ed25519"
+
+// signaturePath returns the path of the detached signature for the given bundle.
+func signaturePath(bundlePath string) string {
+	return bundlePath + ".sig"
+}
+
+// signBundle writes a detached ed25519 signature for the bundle using the PKCS #8 PEM private
+// key at keyPath, as generated by `openssl genpkey -algorithm ed25519`.
+func signBundle(keyPath, bundlePath string) (*signedStatement, error) {
+	privateKey, err := readPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	statement, err := newSignedStatement(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	statementBytes, err := json.Marshal(statement)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal signed statement")
+	}
+
+	signature := bundleSignature{
+		Algorithm: signatureAlgorithm,
+		Statement: statementBytes,
+		Signature: ed25519.Sign(privateKey, statementBytes),
+	}
+	data, err := json.MarshalIndent(signature, "", "    ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal signature")
+	}
+
+	if err := ioutil.WriteFile(signaturePath(bundlePath), append(data, '\n'), 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %s", signaturePath(bundlePath))
+	}
+
+	return statement, nil
+}
+
+// verifyBundle checks the detached signature of the bundle against the PEM public key at
+// keyPath, and that both the bundle and the manifest inside it match the signed digests.
+func verifyBundle(keyPath, bundlePath string) (*signedStatement, error) {
+	publicKey, err := readPublicKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(signaturePath(bundlePath))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", signaturePath(bundlePath))
+	}
+
+	var signature bundleSignature
+	if err := json.Unmarshal(data, &signature); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", signaturePath(bundlePath))
+	}
+	if signature.Algorithm != signatureAlgorithm {
+		return nil, errors.Errorf("unsupported signature algorithm %s", signature.Algorithm)
+	}
+	var statementBytes bytes.Buffer
+	if err := json.Compact(&statementBytes, signature.Statement); err != nil {
+		return nil, errors.Wrap(err, "failed to parse signed statement")
+	}
+	if !ed25519.Verify(publicKey, statementBytes.Bytes(), signature.Signature) {
+		return nil, errors.New("signature does not match the public key")
+	}
+
+	var signed signedStatement
+	if err := json.Unmarshal(signature.Statement, &signed); err != nil {
+		return nil, errors.Wrap(err, "failed to parse signed statement")
+	}
+
+	actual, err := newSignedStatement(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case actual.BundleSHA256 != signed.BundleSHA256:
+		return &signed, errors.Errorf("bundle digest %s does not match signed digest %s", actual.BundleSHA256, signed.BundleSHA256)
+	case actual.ManifestSHA256 != signed.ManifestSHA256:
+		return &signed, errors.Errorf("manifest digest %s does not match signed digest %s", actual.ManifestSHA256, signed.ManifestSHA256)
+	case actual.PluginId != signed.PluginId || actual.Version != signed.Version:
+		return &signed, errors.Errorf("bundle contains %s %s, but %s %s was signed", actual.PluginId, actual.Version, signed.PluginId, signed.Version)
+	}
+
+	return &signed, nil
+}
+
+// newSignedStatement computes the digests of the bundle and of the manifest inside it.
+func newSignedStatement(bundlePath string) (*signedStatement, error) {
+	bundleFile, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", bundlePath)
+	}
+	defer bundleFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, bundleFile); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", bundlePath)
+	}
+
+	bundleManifest, err := readBundleManifest(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	manifestHash := sha256.Sum256(bundleManifest.Data)
+
+	return &signedStatement{
+		Bundle:         filepath.Base(bundlePath),
+		BundleSHA256:   hex.EncodeToString(hash.Sum(nil)),
+		PluginId:       bundleManifest.Manifest.Id,
+		Version:        bundleManifest.Manifest.Version,
+		ManifestSHA256: hex.EncodeToString(manifestHash[:]),
+	}, nil
+}
+
+func readPrivateKey(keyPath string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse private key %s", keyPath)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("%s is not an ed25519 private key", keyPath)
+	}
+
+	return privateKey, nil
+}
+
+func readPublicKey(keyPath string) (ed25519.PublicKey, error) {
+	block, err := readPEM(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse public key %s", keyPath)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("%s is not an ed25519 public key", keyPath)
+	}
+
+	return publicKey, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("%s is not PEM encoded", path)
+	}
+
+	return block, nil
+}
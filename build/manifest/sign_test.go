@@ -0,0 +1,282 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const signManifest = `{"id": "com.example.test", "version": "0.1.0", "webapp": {"bundle_path": "webapp/dist/main.js"}}`
+
+// writeTestBundle writes a bundle containing the given files under the plugin's directory.
+func writeTestBundle(t *testing.T, bundlePath string, files map[string]string) {
+	t.Helper()
+
+	file, err := os.Create(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		header := &tar.Header{
+			Name:     "com.example.test/" + name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(files[name])),
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestKey writes key to path as a PEM block of the given type.
+func writeTestKey(t *testing.T, path, blockType string, key []byte) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestKeyPair writes a new ed25519 key pair in the formats generated by openssl.
+func writeTestKeyPair(t *testing.T, privatePath, publicPath string) ed25519.PrivateKey {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestKey(t, privatePath, "PRIVATE KEY", privateBytes)
+
+	publicBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestKey(t, publicPath, "PUBLIC KEY", publicBytes)
+
+	return privateKey
+}
+
+func TestSignBundle(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// modify runs between signing and verifying the bundle.
+		modify func(t *testing.T, dir, bundlePath string, privateKey ed25519.PrivateKey)
+		err    string
+	}{
+		{
+			name: "round trip",
+		},
+		{
+			name: "bundle changed after signing",
+			modify: func(t *testing.T, dir, bundlePath string, privateKey ed25519.PrivateKey) {
+				writeTestBundle(t, bundlePath, map[string]string{
+					"plugin.json":         signManifest,
+					"webapp/dist/main.js": "console.log('changed');\n",
+				})
+			},
+			err: "bundle digest",
+		},
+		{
+			name: "manifest mismatch in statement",
+			modify: func(t *testing.T, dir, bundlePath string, privateKey ed25519.PrivateKey) {
+				statement, err := newSignedStatement(bundlePath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				statement.Version = "0.2.0"
+				statementBytes, err := json.Marshal(statement)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := json.Marshal(bundleSignature{
+					Algorithm: signatureAlgorithm,
+					Statement: statementBytes,
+					Signature: ed25519.Sign(privateKey, statementBytes),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(signaturePath(bundlePath), data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "bundle contains com.example.test 0.1.0, but com.example.test 0.2.0 was signed",
+		},
+		{
+			name: "wrong public key",
+			modify: func(t *testing.T, dir, bundlePath string, privateKey ed25519.PrivateKey) {
+				writeTestKeyPair(t, filepath.Join(dir, "other.pem"), filepath.Join(dir, "public.pem"))
+			},
+			err: "signature does not match the public key",
+		},
+		{
+			name: "public key not PEM encoded",
+			modify: func(t *testing.T, dir, bundlePath string, privateKey ed25519.PrivateKey) {
+				if err := ioutil.WriteFile(filepath.Join(dir, "public.pem"), []byte("not a key\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "public.pem is not PEM encoded",
+		},
+		{
+			name: "public key not ed25519",
+			modify: func(t *testing.T, dir, bundlePath string, privateKey ed25519.PrivateKey) {
+				key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				publicBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeTestKey(t, filepath.Join(dir, "public.pem"), "PUBLIC KEY", publicBytes)
+			},
+			err: "public.pem is not an ed25519 public key",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "sign")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			privatePath := filepath.Join(dir, "private.pem")
+			publicPath := filepath.Join(dir, "public.pem")
+			privateKey := writeTestKeyPair(t, privatePath, publicPath)
+
+			bundlePath := filepath.Join(dir, "com.example.test-0.1.0.tar.gz")
+			writeTestBundle(t, bundlePath, map[string]string{
+				"plugin.json":         signManifest,
+				"webapp/dist/main.js": "console.log('test');\n",
+			})
+
+			signed, err := signBundle(privatePath, bundlePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signed.PluginId != "com.example.test" || signed.Version != "0.1.0" {
+				t.Errorf("expected com.example.test 0.1.0 to be signed, got %s %s", signed.PluginId, signed.Version)
+			}
+
+			if test.modify != nil {
+				test.modify(t, dir, bundlePath, privateKey)
+			}
+
+			verified, err := verifyBundle(publicPath, bundlePath)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *verified != *signed {
+				t.Errorf("expected statement %+v, got %+v", signed, verified)
+			}
+		})
+	}
+}
+
+func TestSignBundleKeys(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		key  func(t *testing.T, keyPath string)
+		err  string
+	}{
+		{
+			name: "not PEM encoded",
+			key: func(t *testing.T, keyPath string) {
+				if err := ioutil.WriteFile(keyPath, []byte("not a key\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "private.pem is not PEM encoded",
+		},
+		{
+			name: "not PKCS #8",
+			key: func(t *testing.T, keyPath string) {
+				writeTestKey(t, keyPath, "PRIVATE KEY", []byte("garbage"))
+			},
+			err: "failed to parse private key",
+		},
+		{
+			name: "not ed25519",
+			key: func(t *testing.T, keyPath string) {
+				key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				privateBytes, err := x509.MarshalPKCS8PrivateKey(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeTestKey(t, keyPath, "PRIVATE KEY", privateBytes)
+			},
+			err: "private.pem is not an ed25519 private key",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "sign")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			bundlePath := filepath.Join(dir, "com.example.test-0.1.0.tar.gz")
+			writeTestBundle(t, bundlePath, map[string]string{"plugin.json": signManifest})
+
+			keyPath := filepath.Join(dir, "private.pem")
+			test.key(t, keyPath)
+
+			_, err = signBundle(keyPath, bundlePath)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+			if _, err := os.Stat(signaturePath(bundlePath)); !os.IsNotExist(err) {
+				t.Errorf("expected no signature to be written, got %v", err)
+			}
+		})
+	}
+}
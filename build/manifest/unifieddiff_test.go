@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		a, b     []string
+		expected []diffOp
+	}{
+		{"empty", nil, nil, nil},
+		{"insert", nil, []string{"a"}, []diffOp{{'+', "a"}}},
+		{"delete", []string{"a"}, nil, []diffOp{{'-', "a"}}},
+		{"equal", []string{"a", "b"}, []string{"a", "b"}, []diffOp{{' ', "a"}, {' ', "b"}}},
+		{
+			"replace",
+			[]string{"a", "b", "c"},
+			[]string{"a", "x", "c"},
+			[]diffOp{{' ', "a"}, {'-', "b"}, {'+', "x"}, {' ', "c"}},
+		},
+		{
+			"move",
+			[]string{"a", "b", "c"},
+			[]string{"b", "c", "a"},
+			[]diffOp{{'-', "a"}, {' ', "b"}, {' ', "c"}, {'+', "a"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if ops := diffLines(test.a, test.b); !reflect.DeepEqual(ops, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, ops)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{
+			"change",
+			"a\nb\nc\n",
+			"a\nx\nc\n",
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			"created",
+			"",
+			"a\n",
+			"--- old\n+++ new\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n",
+		},
+		{
+			"newline added",
+			"a\nb",
+			"a\nb\n",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"newline removed",
+			"a\n",
+			"a",
+			"--- old\n+++ new\n@@ -1,1 +1,1 @@\n-a\n+a\n\\ No newline at end of file\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := unifiedDiff("old", "new", []byte(test.a), []byte(test.b)); diff != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, diff)
+			}
+		})
+	}
+}
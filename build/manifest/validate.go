@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/blang/semver"
+	"github.com/mattermost/mattermost-server/model"
+)
+
+const (
+	minIdLength = 3
+	maxIdLength = 190
+)
+
+var validIdRegex = regexp.MustCompile(`^[a-zA-Z0-9-_\.]+$`)
+
+// settingTypes are the PluginSetting types understood by the vendored server model.
+var settingTypes = map[string]bool{
+	"bool":      true,
+	"dropdown":  true,
+	"generated": true,
+	"radio":     true,
+	"text":      true,
+	"longtext":  true,
+	"username":  true,
+}
+
+// diagnostic describes a single problem found in the manifest, located by its JSON path.
+type diagnostic struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (d diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Path, d.Message)
+}
+
+// validateManifest checks every field of the manifest, returning a diagnostic for each problem found.
+func validateManifest(manifest *model.Manifest) []diagnostic {
+	var diagnostics []diagnostic
+	report := func(path, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, diagnostic{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case manifest.Id == "":
+		report("id", "must be set")
+	case len(manifest.Id) < minIdLength || len(manifest.Id) > maxIdLength:
+		report("id", "must be between %d and %d characters long", minIdLength, maxIdLength)
+	case !validIdRegex.MatchString(manifest.Id):
+		report("id", "must match %s", validIdRegex.String())
+	}
+
+	if manifest.Version == "" {
+		report("version", "must be set")
+	} else if _, err := semver.Parse(manifest.Version); err != nil {
+		report("version", "%q is not a semantic version: %s", manifest.Version, err.Error())
+	}
+
+	// MeetMinServerVersion parses min_server_version the same way when the server loads the plugin.
+	if manifest.MinServerVersion != "" {
+		if _, err := semver.Parse(manifest.MinServerVersion); err != nil {
+			report("min_server_version", "%q is not a semantic version: %s", manifest.MinServerVersion, err.Error())
+		}
+	}
+
+	if manifest.Server != nil {
+		validateServer("server", manifest.Server, report)
+	}
+	if manifest.Backend != nil {
+		validateServer("backend", manifest.Backend, report)
+	}
+
+	if manifest.Webapp != nil && manifest.Webapp.BundlePath == "" {
+		report("webapp.bundle_path", "must be set when webapp is defined")
+	}
+
+	if manifest.SettingsSchema != nil {
+		validateSettings(manifest.SettingsSchema, report)
+	}
+
+	return diagnostics
+}
+
+func validateServer(path string, server *model.ManifestServer, report func(path, format string, args ...interface{})) {
+	if server.Executable != "" {
+		return
+	}
+
+	if server.Executables == nil ||
+		(server.Executables.LinuxAmd64 == "" && server.Executables.DarwinAmd64 == "" && server.Executables.WindowsAmd64 == "") {
+		report(path, "must define executable or at least one of executables")
+	}
+}
+
+func validateSettings(schema *model.PluginSettingsSchema, report func(path, format string, args ...interface{})) {
+	keys := make(map[string]int)
+
+	for i, setting := range schema.Settings {
+		path := fmt.Sprintf("settings_schema.settings[%d]", i)
+		if setting == nil {
+			report(path, "must not be null")
+			continue
+		}
+
+		if setting.Key == "" {
+			report(path+".key", "must be set")
+		} else if first, ok := keys[setting.Key]; ok {
+			report(path+".key", "duplicates key %q of settings_schema.settings[%d]", setting.Key, first)
+		} else {
+			keys[setting.Key] = i
+		}
+
+		if !settingTypes[setting.Type] {
+			report(path+".type", "unknown setting type %q", setting.Type)
+			continue
+		}
+
+		values := make(map[string]bool)
+		for j, option := range setting.Options {
+			optionPath := fmt.Sprintf("%s.options[%d]", path, j)
+			if option == nil {
+				report(optionPath, "must not be null")
+				continue
+			}
+			if values[option.Value] {
+				report(optionPath+".value", "duplicates option value %q", option.Value)
+			}
+			values[option.Value] = true
+		}
+
+		switch setting.Type {
+		case "dropdown", "radio":
+			if len(setting.Options) == 0 {
+				report(path+".options", "must list at least one option for %s settings", setting.Type)
+			}
+		default:
+			if len(setting.Options) > 0 {
+				report(path+".options", "are only supported by dropdown and radio settings")
+			}
+		}
+
+		if setting.Default == nil {
+			continue
+		}
+
+		switch setting.Type {
+		case "bool":
+			if _, ok := setting.Default.(bool); !ok {
+				report(path+".default", "must be a boolean for bool settings")
+			}
+
+		case "dropdown", "radio":
+			value, ok := setting.Default.(string)
+			if !ok {
+				report(path+".default", "must be a string for %s settings", setting.Type)
+			} else if len(values) > 0 && !values[value] {
+				report(path+".default", "%q is not one of the options", value)
+			}
+
+		default:
+			if _, ok := setting.Default.(string); !ok {
+				report(path+".default", "must be a string for %s settings", setting.Type)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+func TestValidateManifest(t *testing.T) {
+	setting := func(key, settingType string, defaultValue interface{}, options ...string) *model.PluginSetting {
+		s := &model.PluginSetting{Key: key, Type: settingType, Default: defaultValue}
+		for _, option := range options {
+			s.Options = append(s.Options, &model.PluginOption{DisplayName: option, Value: option})
+		}
+		return s
+	}
+
+	for _, test := range []struct {
+		name     string
+		modify   func(manifest *model.Manifest)
+		expected []string
+	}{
+		{"valid", func(m *model.Manifest) {}, nil},
+		{"missing id", func(m *model.Manifest) { m.Id = "" }, []string{"id: must be set"}},
+		{"short id", func(m *model.Manifest) { m.Id = "ab" }, []string{"id: must be between 3 and 190 characters long"}},
+		{"invalid id", func(m *model.Manifest) { m.Id = "com example" }, []string{`id: must match ^[a-zA-Z0-9-_\.]+$`}},
+		{"missing version", func(m *model.Manifest) { m.Version = "" }, []string{"version: must be set"}},
+		{"invalid version", func(m *model.Manifest) { m.Version = "1.0" }, []string{`version: "1.0" is not a semantic version`}},
+		{"invalid min_server_version", func(m *model.Manifest) { m.MinServerVersion = "v5" }, []string{`min_server_version: "v5" is not a semantic version`}},
+		{
+			"server without executables",
+			func(m *model.Manifest) { m.Server = &model.ManifestServer{} },
+			[]string{"server: must define executable or at least one of executables"},
+		},
+		{
+			"backend without executables",
+			func(m *model.Manifest) { m.Backend = &model.ManifestServer{Executables: &model.ManifestExecutables{}} },
+			[]string{"backend: must define executable or at least one of executables"},
+		},
+		{
+			"server with a single executable",
+			func(m *model.Manifest) { m.Server = &model.ManifestServer{Executable: "server/dist/plugin"} },
+			nil,
+		},
+		{
+			"webapp without bundle_path",
+			func(m *model.Manifest) { m.Webapp = &model.ManifestWebapp{} },
+			[]string{"webapp.bundle_path: must be set when webapp is defined"},
+		},
+		{
+			"null setting",
+			func(m *model.Manifest) { m.SettingsSchema.Settings = []*model.PluginSetting{nil} },
+			[]string{"settings_schema.settings[0]: must not be null"},
+		},
+		{
+			"missing key",
+			func(m *model.Manifest) { m.SettingsSchema.Settings = []*model.PluginSetting{setting("", "text", nil)} },
+			[]string{"settings_schema.settings[0].key: must be set"},
+		},
+		{
+			"duplicate key",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "text", nil), setting("a", "bool", nil)}
+			},
+			[]string{`settings_schema.settings[1].key: duplicates key "a" of settings_schema.settings[0]`},
+		},
+		{
+			"unknown type",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "number", nil)}
+			},
+			[]string{`settings_schema.settings[0].type: unknown setting type "number"`},
+		},
+		{
+			"null option",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{{Key: "a", Type: "radio", Options: []*model.PluginOption{nil}}}
+			},
+			[]string{"settings_schema.settings[0].options[0]: must not be null"},
+		},
+		{
+			"duplicate option",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "dropdown", nil, "x", "x")}
+			},
+			[]string{`settings_schema.settings[0].options[1].value: duplicates option value "x"`},
+		},
+		{
+			"dropdown without options",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "dropdown", nil)}
+			},
+			[]string{"settings_schema.settings[0].options: must list at least one option for dropdown settings"},
+		},
+		{
+			"options on text",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "text", nil, "x")}
+			},
+			[]string{"settings_schema.settings[0].options: are only supported by dropdown and radio settings"},
+		},
+		{
+			"bool with string default",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "bool", "true")}
+			},
+			[]string{"settings_schema.settings[0].default: must be a boolean for bool settings"},
+		},
+		{
+			"radio with boolean default",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "radio", true, "x")}
+			},
+			[]string{"settings_schema.settings[0].default: must be a string for radio settings"},
+		},
+		{
+			"dropdown default not an option",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "dropdown", "y", "x")}
+			},
+			[]string{`settings_schema.settings[0].default: "y" is not one of the options`},
+		},
+		{
+			"text with boolean default",
+			func(m *model.Manifest) {
+				m.SettingsSchema.Settings = []*model.PluginSetting{setting("a", "text", false)}
+			},
+			[]string{"settings_schema.settings[0].default: must be a string for text settings"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			manifest := &model.Manifest{
+				Id:             "com.example.test",
+				Version:        "0.1.0",
+				SettingsSchema: &model.PluginSettingsSchema{},
+			}
+			test.modify(manifest)
+
+			var diagnostics []string
+			for _, diagnostic := range validateManifest(manifest) {
+				diagnostics = append(diagnostics, diagnostic.String())
+			}
+
+			// Semantic version errors end with the parser's explanation, which isn't ours to test.
+			for i := range diagnostics {
+				if i < len(test.expected) && strings.HasSuffix(test.expected[i], "is not a semantic version") {
+					diagnostics[i] = diagnostics[i][:strings.Index(diagnostics[i], "is not a semantic version")+len("is not a semantic version")]
+				}
+			}
+
+			if !reflect.DeepEqual(diagnostics, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, diagnostics)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/pkg/errors"
+)
+
+// watchOptions controls how often watch polls for changes and what it does with them.
+type watchOptions struct {
+	// Interval is how often the watched files are polled.
+	Interval time.Duration
+	// Debounce is how long the files must stay unchanged before an iteration starts.
+	Debounce time.Duration
+	// Deploy uploads the bundle after each iteration when deploy credentials are configured.
+	Deploy bool
+}
+
+// watchTrigger names a group of watched files, each of which reruns different steps.
+type watchTrigger string
+
+const (
+	watchManifest watchTrigger = "manifest"
+	watchServer   watchTrigger = "server"
+	watchWebapp   watchTrigger = "webapp"
+)
+
+// watchStep is the outcome of a single step of an iteration.
+type watchStep struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration_ns"`
+	Skipped  string        `json:"skipped,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// watchIteration describes a single rebuild, written as one status line or JSON document.
+type watchIteration struct {
+	Time     time.Time      `json:"time"`
+	Triggers []watchTrigger `json:"triggers"`
+	Steps    []watchStep    `json:"steps"`
+	OK       bool           `json:"ok"`
+}
+
+// fileState is the part of a file's metadata used to detect changes.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchSnapshot records the state of every watched file, grouped by trigger.
+type watchSnapshot map[watchTrigger]map[string]fileState
+
+// watchPlugin reruns apply, the server build, bundle and deploy as the manifest, the server
+// sources and the webapp bundle change, until interrupted. Each change only reruns the steps
+// that depend on it, and a failed step skips the steps that follow it.
+func watchPlugin(r *reporter, p *project, manifestPath string, options watchOptions) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	// Start with a full build, so that the deployed plugin reflects the tree being watched.
+	writeWatchIteration(r, runWatchIteration(p, manifestPath, options, []watchTrigger{watchManifest, watchServer, watchWebapp}))
+	last := takeWatchSnapshot(p, manifestPath)
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	debouncer := &watchDebouncer{debounce: options.Debounce}
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+		}
+
+		current := takeWatchSnapshot(p, manifestPath)
+		triggers := debouncer.observe(last.changed(current), time.Now())
+		last = current
+
+		if len(triggers) == 0 {
+			continue
+		}
+
+		writeWatchIteration(r, runWatchIteration(p, manifestPath, options, triggers))
+
+		// Files written by the iteration itself, such as the generated manifests and the
+		// server executables, must not trigger another one.
+		last = takeWatchSnapshot(p, manifestPath)
+	}
+}
+
+// watchDebouncer accumulates the triggers changed across polls until the watched files have
+// stayed unchanged for the debounce period.
+type watchDebouncer struct {
+	debounce  time.Duration
+	pending   []watchTrigger
+	changedAt time.Time
+}
+
+// observe records the triggers changed by a poll at now, returning every pending trigger once
+// nothing has changed for the debounce period, and nil until then.
+func (d *watchDebouncer) observe(changed []watchTrigger, now time.Time) []watchTrigger {
+	if len(changed) > 0 {
+		d.pending = mergeWatchTriggers(d.pending, changed)
+		d.changedAt = now
+	}
+
+	if len(d.pending) == 0 || now.Sub(d.changedAt) < d.debounce {
+		return nil
+	}
+
+	triggers := d.pending
+	d.pending = nil
+
+	return triggers
+}
+
+// runWatchIteration runs the steps affected by the given triggers.
+func runWatchIteration(p *project, manifestPath string, options watchOptions, triggers []watchTrigger) *watchIteration {
+	iteration := &watchIteration{Time: time.Now(), Triggers: triggers, OK: true}
+
+	var failed bool
+	step := func(name string, fn func() (string, error)) {
+		result := watchStep{Name: name}
+		if failed {
+			result.Skipped = "an earlier step failed"
+		} else {
+			start := time.Now()
+			skipped, err := fn()
+			result.Duration = time.Since(start)
+			result.Skipped = skipped
+			if err != nil {
+				result.Error = err.Error()
+				failed = true
+				iteration.OK = false
+			}
+		}
+		iteration.Steps = append(iteration.Steps, result)
+	}
+
+	// The manifest is reread on every iteration, since any step may depend on it.
+	var manifest *model.Manifest
+	step("manifest", func() (string, error) {
+		watched := *p
+		watched.ManifestPath = manifestPath
+
+		var err error
+		manifest, _, err = findManifest(&watched, true)
+		return "", err
+	})
+
+	hasTrigger := func(trigger watchTrigger) bool {
+		for _, t := range triggers {
+			if t == trigger {
+				return true
+			}
+		}
+		return false
+	}
+
+	if hasTrigger(watchManifest) {
+		step("apply", func() (string, error) {
+			_, err := applyManifest(p, manifest)
+			return "", err
+		})
+	}
+	if hasTrigger(watchManifest) || hasTrigger(watchServer) {
+		step("server", func() (string, error) {
+			if !manifest.HasServer() {
+				return "no server", nil
+			}
+			return "", buildServer(p, manifestPath)
+		})
+	}
+
+	step("bundle", func() (string, error) {
+		return "", bundlePlugin(p, manifest, manifestPath, defaultBundlePath(p, manifest))
+	})
+
+	step("deploy", func() (string, error) {
+		config := deployConfigFromEnv()
+		switch {
+		case !options.Deploy:
+			return "disabled", nil
+		case config.SiteURL == "" || (config.Token == "" && (config.Username == "" || config.Password == "")):
+			return "no credentials", nil
+		}
+		return "", deployPlugin(config, manifest.Id, defaultBundlePath(p, manifest))
+	})
+
+	return iteration
+}
+
+// buildServer compiles the server for each platform the manifest declares an executable for,
+// stamping the build metadata, as the Makefile's server target does. A manifest declaring only
+// a fallback executable is built for linux-amd64.
+func buildServer(p *project, manifestPath string) error {
+	goCommand := os.Getenv("GO")
+	if goCommand == "" {
+		goCommand = "go"
+	}
+
+	info, err := collectBuildInfo(p.Root)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", manifestPath)
+	}
+	// A platform matrix names the executables in the bundled copy of the manifest only.
+	if p.Platforms != nil {
+		data, err = setManifestExecutables(data, manifestFormat(manifestPath), p.Platforms)
+		if err != nil {
+			return errors.Wrapf(err, "failed to set executables in %s", manifestPath)
+		}
+	}
+	executables, fallback, err := manifestExecutables(data, manifestFormat(manifestPath))
+	if err != nil {
+		return errors.Wrapf(err, "failed to read executables from %s", manifestPath)
+	}
+	if len(executables) == 0 && fallback != "" {
+		executables = map[string]string{modelPlatforms[0].String(): fallback}
+	}
+
+	names := make([]string, 0, len(executables))
+	for name := range executables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	serverDir := filepath.Dir(p.path(p.ServerManifestPath))
+	for _, name := range names {
+		platform, err := parsePlatform(name)
+		if err != nil {
+			return err
+		}
+		executable := executables[name]
+
+		outputPath, err := filepath.Abs(p.path(executable))
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve %s", executable)
+		}
+
+		cmd := exec.Command(goCommand, "build", "-ldflags", info.ldflags(), "-o", outputPath)
+		cmd.Dir = serverDir
+		cmd.Env = append(os.Environ(), "GOOS="+platform.goOs, "GOARCH="+platform.goArch)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return errors.Errorf("failed to build %s: %s", executable, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return nil
+}
+
+// takeWatchSnapshot stats the manifest, the server's Go sources and the webapp bundle output.
+// Missing files and directories are simply absent from the snapshot.
+func takeWatchSnapshot(p *project, manifestPath string) watchSnapshot {
+	snapshot := watchSnapshot{
+		watchManifest: make(map[string]fileState),
+		watchServer:   make(map[string]fileState),
+		watchWebapp:   make(map[string]fileState),
+	}
+
+	if info, err := os.Stat(manifestPath); err == nil {
+		snapshot[watchManifest][manifestPath] = fileState{info.Size(), info.ModTime()}
+	}
+
+	serverDir := filepath.Dir(p.path(p.ServerManifestPath))
+	walkWatched(serverDir, snapshot[watchServer], func(path string, info os.FileInfo) bool {
+		if info.IsDir() {
+			return path == serverDir || (info.Name() != "dist" && info.Name() != "vendor" && !strings.HasPrefix(info.Name(), "."))
+		}
+		return filepath.Ext(path) == ".go" || info.Name() == "Gopkg.lock"
+	})
+
+	walkWatched(p.path("webapp/dist"), snapshot[watchWebapp], func(path string, info os.FileInfo) bool {
+		return true
+	})
+
+	return snapshot
+}
+
+// walkWatched records the state of the files under root accepted by include, which is also
+// consulted for directories to decide whether to descend into them.
+func walkWatched(root string, files map[string]fileState, include func(path string, info os.FileInfo) bool) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if !include(path, info) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if include(path, info) {
+			files[path] = fileState{info.Size(), info.ModTime()}
+		}
+		return nil
+	})
+}
+
+// changed returns the triggers whose files differ between the two snapshots.
+func (s watchSnapshot) changed(other watchSnapshot) []watchTrigger {
+	var triggers []watchTrigger
+	for _, trigger := range []watchTrigger{watchManifest, watchServer, watchWebapp} {
+		before, after := s[trigger], other[trigger]
+		differs := len(before) != len(after)
+		for path, state := range after {
+			if previous, ok := before[path]; !ok || previous.size != state.size || !previous.modTime.Equal(state.modTime) {
+				differs = true
+				break
+			}
+		}
+		if differs {
+			triggers = append(triggers, trigger)
+		}
+	}
+
+	return triggers
+}
+
+func mergeWatchTriggers(a, b []watchTrigger) []watchTrigger {
+	seen := make(map[watchTrigger]bool)
+	var merged []watchTrigger
+	for _, trigger := range append(append([]watchTrigger{}, a...), b...) {
+		if !seen[trigger] {
+			seen[trigger] = true
+			merged = append(merged, trigger)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i] < merged[j] })
+
+	return merged
+}
+
+// writeWatchIteration writes a single status line for the iteration, or a single line of JSON
+// in JSON mode.
+func writeWatchIteration(r *reporter, iteration *watchIteration) {
+	if r.json {
+		json.NewEncoder(r.stdout).Encode(iteration)
+		return
+	}
+
+	writeWatchStatus(r.stdout, iteration)
+}
+
+func writeWatchStatus(w io.Writer, iteration *watchIteration) {
+	triggers := make([]string, 0, len(iteration.Triggers))
+	for _, trigger := range iteration.Triggers {
+		triggers = append(triggers, string(trigger))
+	}
+
+	var steps []string
+	var failure string
+	for _, step := range iteration.Steps {
+		switch {
+		case step.Error != "":
+			steps = append(steps, step.Name+" failed")
+			failure = step.Error
+		case step.Skipped != "":
+			if failure == "" {
+				steps = append(steps, fmt.Sprintf("%s skipped (%s)", step.Name, step.Skipped))
+			}
+		case step.Name == "manifest":
+			// Rereading the manifest is only worth mentioning when it fails.
+		default:
+			steps = append(steps, fmt.Sprintf("%s %s", step.Name, step.Duration.Round(time.Millisecond)))
+		}
+	}
+
+	status := "ok"
+	if !iteration.OK {
+		status = "FAILED"
+	}
+
+	fmt.Fprintf(w, "%s [%s] %s: %s\n", iteration.Time.Format("15:04:05"), strings.Join(triggers, ","), status, strings.Join(steps, ", "))
+	if failure != "" {
+		fmt.Fprintf(w, "    %s\n", strings.Replace(failure, "\n", "\n    ", -1))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchDebouncer(t *testing.T) {
+	type poll struct {
+		at       time.Duration
+		changed  []watchTrigger
+		expected []watchTrigger
+	}
+
+	for _, test := range []struct {
+		name  string
+		polls []poll
+	}{
+		{
+			name: "nothing changed",
+			polls: []poll{
+				{0, nil, nil},
+				{time.Second, nil, nil},
+			},
+		},
+		{
+			name: "waits for the debounce period",
+			polls: []poll{
+				{0, []watchTrigger{watchServer}, nil},
+				{250 * time.Millisecond, nil, nil},
+				{500 * time.Millisecond, nil, []watchTrigger{watchServer}},
+				{750 * time.Millisecond, nil, nil},
+			},
+		},
+		{
+			name: "further changes restart the debounce period",
+			polls: []poll{
+				{0, []watchTrigger{watchServer}, nil},
+				{250 * time.Millisecond, []watchTrigger{watchServer}, nil},
+				{500 * time.Millisecond, nil, nil},
+				{750 * time.Millisecond, nil, []watchTrigger{watchServer}},
+			},
+		},
+		{
+			name: "merges triggers changed during the debounce period",
+			polls: []poll{
+				{0, []watchTrigger{watchWebapp}, nil},
+				{250 * time.Millisecond, []watchTrigger{watchServer, watchWebapp}, nil},
+				{500 * time.Millisecond, []watchTrigger{watchManifest}, nil},
+				{time.Second, nil, []watchTrigger{watchManifest, watchServer, watchWebapp}},
+			},
+		},
+		{
+			name: "later changes start a new iteration",
+			polls: []poll{
+				{0, []watchTrigger{watchWebapp}, nil},
+				{500 * time.Millisecond, nil, []watchTrigger{watchWebapp}},
+				{750 * time.Millisecond, []watchTrigger{watchManifest}, nil},
+				{1250 * time.Millisecond, nil, []watchTrigger{watchManifest}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+			debouncer := &watchDebouncer{debounce: 500 * time.Millisecond}
+			for _, poll := range test.polls {
+				triggers := debouncer.observe(poll.changed, start.Add(poll.at))
+				if !reflect.DeepEqual(triggers, poll.expected) {
+					t.Errorf("at %s: expected triggers %q, got %q", poll.at, poll.expected, triggers)
+				}
+			}
+		})
+	}
+}
@@ -4,26 +4,49 @@ ifeq ($(GO),)
     $(error "go is not available: see https://golang.org/doc/install")
 endif
 
+# Ensure that go is at least 1.13, the first release with crypto/ed25519, which the build tools
+# use to sign bundles.
+ifeq ($(shell $(GO) version | grep -E 'go1\.(1[3-9]|[2-9][0-9])([. ]|$$)'),)
+    $(error "go 1.13 or later is required, found $(shell $(GO) version)")
+endif
+
 # Ensure that the build tools are compiled. Go's caching makes this quick.
 $(shell cd build/manifest && $(GO) build -o ../bin/manifest)
 
-# Extract the plugin id from the manifest.
-PLUGIN_ID ?= $(shell build/bin/manifest id)
+# Invokes the manifest tool against the configured manifest and server platforms.
+MANIFEST = build/bin/manifest --platforms "$(SERVER_PLATFORMS)"
+ifneq ($(MANIFEST_FILE),)
+    MANIFEST += --manifest $(MANIFEST_FILE)
+endif
+ifneq ($(GIT_VERSION),)
+    MANIFEST += --git-version
+endif
+
+# Extract the plugin id from the manifest. The manifest tool explains any failure on stderr.
+PLUGIN_ID ?= $(shell $(MANIFEST) id)
 ifeq ($(PLUGIN_ID),)
-    $(error "Cannot parse id from $(MANIFEST_FILE)")
+    $(error "Cannot parse id from the manifest, see the error above")
 endif
 
-# Extract the plugin version from the manifest.
-PLUGIN_VERSION ?= $(shell build/bin/manifest version)
+# Extract the plugin version from the manifest, or from git tags if GIT_VERSION is set.
+PLUGIN_VERSION ?= $(shell $(MANIFEST) version)
 ifeq ($(PLUGIN_VERSION),)
-    $(error "Cannot parse version from $(MANIFEST_FILE)")
+    $(error "Cannot parse version from the manifest, see the error above")
 endif
 
 # Determine if a server is defined in the manifest.
-HAS_SERVER ?= $(shell build/bin/manifest has_server)
+HAS_SERVER ?= $(shell $(MANIFEST) has_server)
 
 # Determine if a webapp is defined in the manifest.
-HAS_WEBAPP ?= $(shell build/bin/manifest has_webapp)
+HAS_WEBAPP ?= $(shell $(MANIFEST) has_webapp)
+
+# Determine the build metadata stamped into the server: the git commit, whether the tree is dirty
+# and the build time. Evaluated once, so that every platform shares the same metadata.
+ifneq ($(HAS_SERVER),)
+ifeq ($(SERVER_LDFLAGS),)
+    SERVER_LDFLAGS := $(shell $(MANIFEST) buildinfo --ldflags)
+endif
+endif
 
 # Try looking for dep in $(GOPATH) in case $(GOPATH)/bin isn't in $(PATH).
 GOPATH ?= $(shell $(GO) env GOPATH)